@@ -0,0 +1,365 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ButtonKind identifies the kind of a ButtonEvent.
+type ButtonKind int
+
+// These are the kinds of button event.
+const (
+	// ButtonPress and ButtonRelease report every debounced change
+	// of the button state.
+	ButtonPress ButtonKind = iota
+	ButtonRelease
+
+	// ButtonClick follows the release of a short press that was not
+	// the first of a double click. It is reported, with the time of
+	// the release, once that is known: when the double click time
+	// expires, or when a second press within that time becomes a
+	// long press. In the latter case, it follows the ButtonPress of
+	// the second press.
+	ButtonClick
+
+	// ButtonDoubleClick follows the release of the second of two
+	// short presses.
+	ButtonDoubleClick
+
+	// ButtonLongPress reports the button has been held for the
+	// long press time, after which ButtonRepeat is reported
+	// periodically until it is released.
+	ButtonLongPress
+	ButtonRepeat
+)
+
+// String names the kind of a button event.
+func (k ButtonKind) String() string {
+	switch k {
+	case ButtonPress:
+		return "press"
+	case ButtonRelease:
+		return "release"
+	case ButtonClick:
+		return "click"
+	case ButtonDoubleClick:
+		return "double-click"
+	case ButtonLongPress:
+		return "long-press"
+	case ButtonRepeat:
+		return "repeat"
+	}
+	return fmt.Sprintf("ButtonKind(%d)", int(k))
+}
+
+// ButtonEvent is an event generated by a Button.
+type ButtonEvent struct {
+	When time.Time
+	Kind ButtonKind
+}
+
+// ButtonConfig holds the settings of a Button. The zero values of the
+// times select their defaults, and negative values disable the
+// corresponding feature.
+type ButtonConfig struct {
+	// ActiveLow indicates the button pulls its line low when
+	// pressed.
+	ActiveLow bool
+
+	// Debounce is how long the line must hold a new level for the
+	// change to be accepted (default 20ms).
+	Debounce time.Duration
+
+	// DoubleClick is the longest time from the release of a click
+	// to the next press for the two to be a double click (default
+	// 300ms). When disabled, every short press is a click, reported
+	// without delay.
+	DoubleClick time.Duration
+
+	// LongPress is how long the button must be held for a long
+	// press (default 1s), and Repeat, if non-zero, is the interval
+	// of the repeat events that follow.
+	LongPress, Repeat time.Duration
+
+	// Mirror, if non-nil, has its MirrorIndex flag set to the
+	// debounced state of the button.
+	Mirror      *Flag
+	MirrorIndex int
+}
+
+// defaults fills in the unspecified values of c.
+func (c ButtonConfig) defaults() ButtonConfig {
+	if c.Debounce == 0 {
+		c.Debounce = 20 * time.Millisecond
+	}
+	if c.DoubleClick == 0 {
+		c.DoubleClick = 300 * time.Millisecond
+	}
+	if c.LongPress == 0 {
+		c.LongPress = time.Second
+	}
+	return c
+}
+
+// buttonDepth is the number of undelivered events a Button holds.
+// Further events are dropped until the receiver catches up.
+const buttonDepth = 64
+
+// Button generates events from the debounced state of a watched input
+// line, such as a Bank input wired to a push button. Events are
+// generated in the order of the edge timestamps, so they do not depend
+// on how promptly the edges are processed. The one exception is a
+// ButtonClick that is only resolved by a following long press.
+type Button struct {
+	cfg    ButtonConfig
+	events chan ButtonEvent
+
+	// pressed is the debounced state. If pending is set, the line
+	// changed from it at pendAt and is waiting to be debounced.
+	pressed bool
+	pending bool
+	pendAt  time.Time
+
+	// pressAt is the time of the last press, and long indicates it
+	// has become a long press, repeating next at repeatAt.
+	pressAt  time.Time
+	long     bool
+	repeatAt time.Time
+
+	// clicked indicates a click, released at clickAt, may yet be
+	// the first of a double click.
+	clicked bool
+	clickAt time.Time
+
+	err    error
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewButton generates the events of a button on line index of io,
+// which must be a Watcher, until ctx is done or Close() is called.
+func NewButton(ctx context.Context, io IO[bool], index int, cfg ButtonConfig) (*Button, error) {
+	cfg = cfg.defaults()
+	if cfg.Repeat < 0 {
+		return nil, fmt.Errorf("invalid button repeat interval %v", cfg.Repeat)
+	}
+	if cfg.Mirror != nil {
+		if err := cfg.Mirror.valid(cfg.MirrorIndex); err != nil {
+			return nil, err
+		}
+	}
+	wt, ok := io.(Watcher)
+	if !ok {
+		return nil, fmt.Errorf("button line cannot be watched")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	edges, err := wt.Watch(ctx, index)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	on, err := io.Get(index)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	b := &Button{
+		cfg:     cfg,
+		events:  make(chan ButtonEvent, buttonDepth),
+		pressed: on != cfg.ActiveLow,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	b.mirror()
+	go b.run(edges)
+	return b, nil
+}
+
+// Events returns the channel over which the button events are
+// delivered. It is closed once the button is closed. Events are
+// dropped if the channel is not drained promptly.
+func (b *Button) Events() <-chan ButtonEvent {
+	return b.events
+}
+
+// Close stops generating events, once the edges already delivered have
+// been processed, and returns the first error encountered while
+// mirroring the button state.
+func (b *Button) Close() error {
+	b.cancel()
+	<-b.done
+	return b.err
+}
+
+// mirror copies the debounced state to the mirror flag.
+func (b *Button) mirror() {
+	if b.cfg.Mirror == nil {
+		return
+	}
+	if err := b.cfg.Mirror.Set(b.cfg.MirrorIndex, b.pressed); err != nil && b.err == nil {
+		b.err = err
+	}
+}
+
+// emit delivers an event.
+func (b *Button) emit(when time.Time, kind ButtonKind) {
+	select {
+	case b.events <- ButtonEvent{When: when, Kind: kind}:
+	default:
+	}
+}
+
+// run processes the edges of the line until it is closed.
+func (b *Button) run(edges <-chan Edge) {
+	defer close(b.done)
+	defer close(b.events)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var queue []Edge
+	for edges != nil || len(queue) != 0 {
+		// Collect the delivered edges, to process them in order
+		// with the timed events.
+		for more := edges != nil; more; {
+			select {
+			case e, ok := <-edges:
+				if !ok {
+					edges, more = nil, false
+					break
+				}
+				queue = append(queue, e)
+			default:
+				more = false
+			}
+		}
+		at, ok := b.deadline()
+		switch {
+		case len(queue) != 0 && (!ok || !queue[0].When.After(at)):
+			b.edge(queue[0])
+			queue = queue[1:]
+			continue
+		case ok && !at.After(time.Now()):
+			b.timeout(at)
+			continue
+		case len(queue) != 0:
+			// A deadline before the next edge.
+			b.timeout(at)
+			continue
+		}
+		var fire <-chan time.Time
+		if ok {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(at))
+			fire = timer.C
+		}
+		select {
+		case e, ok := <-edges:
+			if !ok {
+				edges = nil
+				continue
+			}
+			queue = append(queue, e)
+		case <-fire:
+		}
+	}
+	// The line has held its level until now.
+	for {
+		at, ok := b.deadline()
+		if !ok || !b.pending || at.After(time.Now()) {
+			return
+		}
+		b.timeout(at)
+	}
+}
+
+// deadline returns the time of the next timed event.
+func (b *Button) deadline() (time.Time, bool) {
+	var at time.Time
+	ok := false
+	next := func(t time.Time) {
+		if !ok || t.Before(at) {
+			at, ok = t, true
+		}
+	}
+	if b.pending {
+		next(b.pendAt.Add(b.cfg.Debounce))
+	}
+	switch {
+	case !b.pressed:
+	case !b.long && b.cfg.LongPress > 0:
+		next(b.pressAt.Add(b.cfg.LongPress))
+	case b.long && b.cfg.Repeat > 0:
+		next(b.repeatAt)
+	}
+	if b.clicked && !b.pressed {
+		next(b.clickAt.Add(b.cfg.DoubleClick))
+	}
+	return at, ok
+}
+
+// edge processes an edge of the line.
+func (b *Button) edge(e Edge) {
+	pressed := e.On != b.cfg.ActiveLow
+	switch {
+	case b.cfg.Debounce < 0:
+		if pressed != b.pressed {
+			b.change(e.When)
+		}
+	case pressed == b.pressed:
+		// The line returned to the debounced state.
+		b.pending = false
+	case !b.pending:
+		b.pending, b.pendAt = true, e.When
+	}
+}
+
+// timeout processes the timed event due at time at.
+func (b *Button) timeout(at time.Time) {
+	switch {
+	case b.pending && at.Equal(b.pendAt.Add(b.cfg.Debounce)):
+		b.pending = false
+		b.change(b.pendAt)
+	case b.pressed && !b.long && at.Equal(b.pressAt.Add(b.cfg.LongPress)):
+		if b.clicked {
+			b.clicked = false
+			b.emit(b.clickAt, ButtonClick)
+		}
+		b.long = true
+		b.repeatAt = at.Add(b.cfg.Repeat)
+		b.emit(at, ButtonLongPress)
+	case b.pressed && b.long && at.Equal(b.repeatAt):
+		b.repeatAt = at.Add(b.cfg.Repeat)
+		b.emit(at, ButtonRepeat)
+	case b.clicked && !b.pressed:
+		b.clicked = false
+		b.emit(b.clickAt, ButtonClick)
+	}
+}
+
+// change applies a debounced change of state at time when.
+func (b *Button) change(when time.Time) {
+	b.pressed = !b.pressed
+	b.mirror()
+	if b.pressed {
+		b.pressAt, b.long = when, false
+		b.emit(when, ButtonPress)
+		return
+	}
+	b.emit(when, ButtonRelease)
+	switch {
+	case b.long:
+	case b.clicked:
+		b.clicked = false
+		b.emit(when, ButtonDoubleClick)
+	case b.cfg.DoubleClick < 0:
+		b.emit(when, ButtonClick)
+	default:
+		b.clicked, b.clickAt = true, when
+	}
+}
@@ -0,0 +1,154 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// buttonWire simulates the line of a push button. Its edges are
+// generated in advance and delivered as soon as the line is watched.
+type buttonWire struct {
+	at    time.Time
+	idle  bool
+	level bool
+	edges []Edge
+}
+
+// newButtonWire returns a button line that starts at the idle level.
+func newButtonWire(idle bool) *buttonWire {
+	return &buttonWire{
+		at:    time.Now().Add(-time.Minute),
+		idle:  idle,
+		level: idle,
+	}
+}
+
+func (w *buttonWire) Lines() int             { return 1 }
+func (w *buttonWire) Label(index int) string { return "button" }
+func (w *buttonWire) SetAlias(name string)   {}
+func (w *buttonWire) Set(index int, on bool) error {
+	return errors.New("not supported")
+}
+func (w *buttonWire) SetHold(index int) (chan<- bool, error) {
+	return nil, errors.New("not supported")
+}
+
+// Get returns the level of the line before any of the edges.
+func (w *buttonWire) Get(index int) (bool, error) {
+	return w.idle, nil
+}
+
+func (w *buttonWire) Watch(ctx context.Context, index int) (<-chan Edge, error) {
+	ch := make(chan Edge, edgeDepth)
+	for _, e := range w.edges {
+		ch <- e
+	}
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// toggle adds an edge of the line, dt after the previous one.
+func (w *buttonWire) toggle(dt time.Duration) {
+	w.at = w.at.Add(dt)
+	w.level = !w.level
+	w.edges = append(w.edges, Edge{When: w.at, On: w.level})
+}
+
+// buttonEvents closes a button and returns its events, as strings
+// holding the kind and the time, in milliseconds, since base.
+func buttonEvents(t *testing.T, b *Button, base time.Time) []string {
+	t.Helper()
+	if err := b.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	var got []string
+	for e := range b.Events() {
+		got = append(got, fmt.Sprintf("%v@%d", e.Kind, e.When.Sub(base)/time.Millisecond))
+	}
+	return got
+}
+
+func TestButton(t *testing.T) {
+	w := newButtonWire(false)
+	base := w.at
+	// hold presses the button from ms to ms+d, with the line bouncing
+	// for n transitions 5ms apart at each end.
+	hold := func(ms, d, n int) {
+		for i, at := range []int{ms, ms + d} {
+			w.toggle(base.Add(time.Duration(at) * time.Millisecond).Sub(w.at))
+			for j := 0; j < n && i == 0; j++ {
+				w.toggle(5 * time.Millisecond)
+			}
+		}
+	}
+	hold(100, 100, 2)  // A click, with bounce.
+	hold(1000, 100, 0) // A double click.
+	hold(1200, 100, 0)
+	hold(2000, 1500, 0) // A long press.
+	hold(4000, 5, 0)    // A glitch.
+	hold(5000, 100, 0)  // A click, only resolved by the long press.
+	hold(5300, 1150, 0)
+
+	f := NewFlag()
+	b, err := NewButton(context.Background(), w, 0, ButtonConfig{
+		Repeat:      200 * time.Millisecond,
+		Mirror:      f,
+		MirrorIndex: 3,
+	})
+	if err != nil {
+		t.Fatalf("NewButton failed: %v", err)
+	}
+	want := []string{
+		"press@110", "release@200", "click@200",
+		"press@1000", "release@1100", "press@1200", "release@1300", "double-click@1300",
+		"press@2000", "long-press@3000", "repeat@3200", "repeat@3400", "release@3500",
+		"press@5000", "release@5100", "press@5300", "click@5100", "long-press@6300", "release@6450",
+	}
+	if got := buttonEvents(t, b, base); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events:\n%q\nwant:\n%q", got, want)
+	}
+	if on, _ := f.Get(3); on {
+		t.Error("mirror left pressed")
+	}
+}
+
+func TestButtonActiveLow(t *testing.T) {
+	w := newButtonWire(true)
+	base := w.at
+	w.toggle(100 * time.Millisecond)
+	w.toggle(50 * time.Millisecond)
+	w.toggle(50 * time.Millisecond)
+	w.toggle(50 * time.Millisecond)
+
+	f := NewFlag()
+	b, err := NewButton(context.Background(), w, 0, ButtonConfig{
+		ActiveLow:   true,
+		Debounce:    -1,
+		DoubleClick: -1,
+		Mirror:      f,
+	})
+	if err != nil {
+		t.Fatalf("NewButton failed: %v", err)
+	}
+	want := []string{
+		"press@100", "release@150", "click@150",
+		"press@200", "release@250", "click@250",
+	}
+	if got := buttonEvents(t, b, base); !reflect.DeepEqual(got, want) {
+		t.Errorf("got events:\n%q\nwant:\n%q", got, want)
+	}
+
+	if _, err := NewButton(context.Background(), newI2CSim(), 0, ButtonConfig{}); err == nil {
+		t.Error("unwatchable line accepted")
+	}
+	if _, err := NewButton(context.Background(), w, 0, ButtonConfig{Mirror: f, MirrorIndex: 64}); err == nil {
+		t.Error("invalid mirror index accepted")
+	}
+}
@@ -0,0 +1,171 @@
+package gpio
+
+import (
+	"fmt"
+	"time"
+)
+
+// Change describes a change in the value of a single traced line, or
+// Vector value.
+type Change struct {
+	// When holds the time the change was observed.
+	When time.Time
+
+	// Source is the *Bank, *Flag or *Vector that changed and Module
+	// is the namespace used for it by the tracer.
+	Source Named
+	Module string
+
+	// Index identifies the line, or Vector value, of the source
+	// and Label is the tracer's name for it.
+	Index int
+	Label string
+
+	// Old and New hold the previous and new values. Lines have
+	// values 0 and 1. If Known is false, the line had no prior
+	// traced value and Old is 0.
+	Old, New int64
+	Known    bool
+
+	// Numeric indicates the change is to a Vector value.
+	Numeric bool
+
+	// Text holds the text of an annotation. Annotations have an
+	// Index of -1, no Label and no values.
+	Text string
+}
+
+// Annotation indicates the change is an annotation and not a change
+// of value.
+func (ch Change) Annotation() bool {
+	return ch.Index < 0
+}
+
+// traced holds the most recently traced state of a single source.
+type traced struct {
+	src     Named
+	module  string
+	numeric bool
+
+	// mask and value hold the most recent sample of a Bank or
+	// Flag.
+	mask, value uint64
+
+	// nums holds the most recent Vector values.
+	nums map[int]int64
+
+	// labels holds the labels provided for lines of the source.
+	labels map[int]string
+}
+
+// label returns the label of the indexed line. The default labels
+// match those of iotracer and NumTrace: sig<n> and val<n>.
+func (t *traced) label(index int) string {
+	if lab := t.labels[index]; lab != "" {
+		return lab
+	}
+	if t.numeric {
+		return fmt.Sprintf("val%d", index)
+	}
+	return fmt.Sprintf("sig%d", index)
+}
+
+// changeLog converts the samples received by a tracer into Changes.
+// It is not locked, so the tracer using it must serialize calls to
+// its methods.
+type changeLog struct {
+	srcs  map[Named]*traced
+	order []*traced
+}
+
+// source returns the state of src, adding it with a default module
+// name of src<n> if needed.
+func (c *changeLog) source(src Named) *traced {
+	if c.srcs == nil {
+		c.srcs = make(map[Named]*traced)
+	}
+	t, ok := c.srcs[src]
+	if !ok {
+		t = &traced{
+			src:    src,
+			module: fmt.Sprintf("src%d", len(c.order)),
+			nums:   make(map[int]int64),
+			labels: make(map[int]string),
+		}
+		_, t.numeric = src.(*Vector)
+		c.srcs[src] = t
+		c.order = append(c.order, t)
+	}
+	return t
+}
+
+// module sets the namespace used for src.
+func (c *changeLog) module(src Named, name string) {
+	c.source(src).module = name
+}
+
+// label sets the label of a line of src.
+func (c *changeLog) label(src Named, index int, label string) {
+	c.source(src).labels[index] = label
+}
+
+// sample returns the line changes indicated by a Bank or Flag sample.
+func (c *changeLog) sample(when time.Time, src Named, mask, value uint64) []Change {
+	t := c.source(src)
+	var chs []Change
+	delta := (mask &^ t.mask) | (mask & (value ^ t.value))
+	for _, i := range unpackMask(delta) {
+		bit := uint64(1) << i
+		ch := Change{
+			When:   when,
+			Source: src,
+			Module: t.module,
+			Index:  int(i),
+			Label:  t.label(int(i)),
+			Known:  t.mask&bit != 0,
+		}
+		if ch.Known && t.value&bit != 0 {
+			ch.Old = 1
+		}
+		if value&bit != 0 {
+			ch.New = 1
+		}
+		chs = append(chs, ch)
+	}
+	t.mask |= mask
+	t.value = (t.value &^ mask) | (value & mask)
+	return chs
+}
+
+// annotate returns the change recording an annotation of src.
+func (c *changeLog) annotate(when time.Time, src Named, text string) []Change {
+	t := c.source(src)
+	return []Change{{
+		When:   when,
+		Source: src,
+		Module: t.module,
+		Index:  -1,
+		Text:   text,
+	}}
+}
+
+// sampleNum returns the change indicated by a Vector value sample.
+func (c *changeLog) sampleNum(when time.Time, src Named, index int, value int64) []Change {
+	t := c.source(src)
+	old, known := t.nums[index]
+	if known && old == value {
+		return nil
+	}
+	t.nums[index] = value
+	return []Change{{
+		When:    when,
+		Source:  src,
+		Module:  t.module,
+		Index:   index,
+		Label:   t.label(index),
+		Old:     old,
+		New:     value,
+		Known:   known,
+		Numeric: true,
+	}}
+}
@@ -0,0 +1,191 @@
+package gpio
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// transition is a change of value of a compared VCD variable.
+type transition struct {
+	at    time.Duration
+	value int64
+}
+
+// transitions returns the changes of the known value of variable i.
+// The first entry holds the initial known value.
+func transitions(v *VCD, i int) []transition {
+	var ts []transition
+	for _, ev := range v.Events {
+		if ev.Var != i || !ev.Known {
+			continue
+		}
+		if n := len(ts); n != 0 && ts[n-1].value == ev.Value {
+			continue
+		}
+		ts = append(ts, transition{at: ev.At, value: ev.Value})
+	}
+	return ts
+}
+
+// compareKey identifies a variable independently of the top level
+// scope, which names the application that generated the VCD.
+func compareKey(v VCDVar) string {
+	scope := v.Scope
+	if len(scope) != 0 {
+		scope = scope[1:]
+	}
+	return strings.Join(append(append([]string(nil), scope...), v.Name), ".")
+}
+
+// Divergence describes the first difference between a trace and a
+// golden reference trace found by CompareVCD().
+type Divergence struct {
+	// Name identifies the diverging variable and At is the time
+	// of the divergence in the golden trace.
+	Name string
+	At   time.Duration
+
+	// Reason describes the divergence.
+	Reason string
+
+	// Want and Got describe the transitions of the variable near
+	// the divergence in the golden and compared trace.
+	Want, Got string
+}
+
+// Error reports the divergence and the nearby transitions.
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("trace diverges at %v on %s: %s\n  want: %s\n   got: %s", d.At, d.Name, d.Reason, d.Want, d.Got)
+}
+
+// describe formats the transitions around the k'th entry of ts, which
+// is marked with brackets. Times are shifted by offset.
+func describe(ts []transition, k int, offset time.Duration) string {
+	const context = 2
+	lo, hi := k-context, k+context+1
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(ts) {
+		hi = len(ts)
+	}
+	var parts []string
+	if lo > 0 {
+		parts = append(parts, "...")
+	}
+	for i := lo; i < hi; i++ {
+		s := fmt.Sprintf("%v=%d", ts[i].at-offset, ts[i].value)
+		if i == k {
+			s = "[" + s + "]"
+		}
+		parts = append(parts, s)
+	}
+	if hi < len(ts) {
+		parts = append(parts, "...")
+	} else if k >= len(ts) {
+		parts = append(parts, "[end]")
+	}
+	return strings.Join(parts, " ")
+}
+
+// CompareVCD compares the trace got against the golden reference
+// trace want. Variables are matched by their scope qualified names,
+// ignoring the top level scope, and variables named in ignore (as
+// matched by (*VCD).Find() on want) are not compared. The traces are
+// aligned on their first transition after the initial values, and
+// each subsequent transition must have the same value, and occur
+// within tolerance of the time of the golden transition. The first
+// difference found, in golden trace time order, is returned as a
+// *Divergence error.
+func CompareVCD(want, got *VCD, tolerance time.Duration, ignore ...string) error {
+	skip := make(map[int]bool)
+	for _, name := range ignore {
+		i, ok := want.Find(name)
+		if !ok {
+			return fmt.Errorf("no VCD variable %q to ignore", name)
+		}
+		skip[i] = true
+	}
+	keys := make(map[string]int)
+	for i, v := range got.Vars {
+		keys[compareKey(v)] = i
+	}
+
+	type pair struct {
+		name      string
+		want, got []transition
+	}
+	var pairs []pair
+	var first *Divergence
+	diverge := func(d *Divergence) {
+		if first == nil || d.At < first.At {
+			first = d
+		}
+	}
+	for i, v := range want.Vars {
+		if skip[i] || v.Kind == "string" {
+			continue
+		}
+		name := compareKey(v)
+		j, ok := keys[name]
+		if !ok {
+			diverge(&Divergence{Name: name, Reason: "variable is missing", Want: v.Path(), Got: "-"})
+			continue
+		}
+		pairs = append(pairs, pair{name: name, want: transitions(want, i), got: transitions(got, j)})
+	}
+
+	// Align the traces on the first transition that follows an
+	// initial value.
+	var wantStart, gotStart time.Duration
+	wantAligned, gotAligned := false, false
+	for _, p := range pairs {
+		if len(p.want) > 1 && (!wantAligned || p.want[1].at < wantStart) {
+			wantStart, wantAligned = p.want[1].at, true
+		}
+		if len(p.got) > 1 && (!gotAligned || p.got[1].at < gotStart) {
+			gotStart, gotAligned = p.got[1].at, true
+		}
+	}
+	offset := gotStart - wantStart
+
+	for _, p := range pairs {
+		for k := 0; k < len(p.want) || k < len(p.got); k++ {
+			d := &Divergence{
+				Name: p.name,
+				Want: describe(p.want, k, 0),
+				Got:  describe(p.got, k, offset),
+			}
+			switch {
+			case k >= len(p.want):
+				d.At = p.got[k].at - offset
+				d.Reason = fmt.Sprintf("unexpected change to %d", p.got[k].value)
+			case k >= len(p.got):
+				d.At = p.want[k].at
+				d.Reason = fmt.Sprintf("missing change to %d", p.want[k].value)
+			case p.want[k].value != p.got[k].value:
+				d.At = p.want[k].at
+				d.Reason = fmt.Sprintf("value is %d, want %d", p.got[k].value, p.want[k].value)
+			case k != 0:
+				dt := p.got[k].at - offset - p.want[k].at
+				if dt <= tolerance && -dt <= tolerance {
+					continue
+				}
+				d.At = p.want[k].at
+				d.Reason = fmt.Sprintf("change to %d is %v late (tolerance %v)", p.want[k].value, dt, tolerance)
+				if dt < 0 {
+					d.Reason = fmt.Sprintf("change to %d is %v early (tolerance %v)", p.want[k].value, -dt, tolerance)
+				}
+			default:
+				continue
+			}
+			diverge(d)
+			break
+		}
+	}
+	if first != nil {
+		return first
+	}
+	return nil
+}
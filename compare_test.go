@@ -0,0 +1,75 @@
+package gpio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flagVCD returns the VCD of a two bit flag holding each of values
+// in turn, at the listed millisecond times.
+func flagVCD(t *testing.T, app string, ms []int, values []uint64) *VCD {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := NewVCDWriter(buf, app, time.Microsecond, 0)
+	f := NewFlag()
+	w.Add(f, "flags")
+	w.LabelLine(f, 0, "clk")
+	w.LabelLine(f, 1, "noise")
+	start := time.Now()
+	for i, m := range ms {
+		w.TimedSample(start.Add(time.Duration(m)*time.Millisecond), f, 3, values[i])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	v, err := ReadVCD(buf)
+	if err != nil {
+		t.Fatalf("ReadVCD failed: %v", err)
+	}
+	return v
+}
+
+func TestCompareVCD(t *testing.T) {
+	golden := flagVCD(t, "golden", []int{0, 10, 20, 30}, []uint64{0, 1, 2, 3})
+	vs := []struct {
+		name   string
+		ms     []int
+		values []uint64
+		ignore []string
+		reason string
+	}{
+		{name: "match", ms: []int{0, 15, 26, 35}, values: []uint64{0, 1, 2, 3}},
+		{name: "late", ms: []int{0, 15, 28, 35}, values: []uint64{0, 1, 2, 3}, reason: "change to 0 is 3ms late"},
+		{name: "value", ms: []int{0, 15, 25, 35}, values: []uint64{2, 3, 0, 1}, reason: "value is 1, want 0"},
+		{name: "missing", ms: []int{0, 15, 25}, values: []uint64{0, 1, 2}, reason: "missing change to 1"},
+		{name: "ignored", ms: []int{0, 15, 25, 35}, values: []uint64{2, 1, 0, 1}, ignore: []string{"noise"}},
+	}
+	for _, v := range vs {
+		got := flagVCD(t, "test", v.ms, v.values)
+		err := CompareVCD(golden, got, time.Millisecond, v.ignore...)
+		if v.reason == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected divergence: %v", v.name, err)
+			}
+			continue
+		}
+		d, ok := err.(*Divergence)
+		if !ok {
+			t.Errorf("%s: got %v, want a divergence", v.name, err)
+			continue
+		}
+		if !strings.HasPrefix(d.Reason, v.reason) {
+			t.Errorf("%s: got reason %q, want %q", v.name, d.Reason, v.reason)
+		}
+	}
+
+	err := CompareVCD(golden, flagVCD(t, "test", []int{0, 15, 28, 35}, []uint64{0, 1, 2, 3}), time.Millisecond)
+	if d, ok := err.(*Divergence); !ok || d.Name != "flags.clk" || d.At != 20*time.Millisecond {
+		t.Fatalf("got %v, want flags.clk divergence at 20ms", err)
+	}
+	if want := "  want: 0s=0 10ms=1 [20ms=0] 30ms=1\n   got: -5ms=0 10ms=1 [23ms=0] 30ms=1"; !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("got diff:\n%s\nwant suffix:\n%s", err, want)
+	}
+}
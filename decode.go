@@ -0,0 +1,361 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// These are the errors reported by the protocol decoders in the Err
+// field of a Frame.
+var (
+	ErrFraming    = errors.New("framing error")
+	ErrParity     = errors.New("parity error")
+	ErrIncomplete = errors.New("incomplete frame")
+)
+
+// Frame is a unit of data, or bus condition, decoded from the signals
+// of a trace.
+type Frame struct {
+	// Start and End bound the frame in the time of the decoded
+	// signals.
+	Start, End time.Duration
+
+	// Kind identifies the frame. The decoders generate: "data" (a
+	// UART character or 1-Wire byte); "word" (an SPI word);
+	// "start", "restart", "stop", "address", "write" and "read"
+	// (I2C); and "reset" (1-Wire).
+	Kind string
+
+	// Value holds the decoded data. For SPI, it holds the word
+	// sent by the master (MOSI) and Read holds the word sent by
+	// the slave (MISO). For an I2C address, it holds the whole
+	// address byte, including the read bit.
+	Value, Read uint64
+
+	// Ack is set for an acknowledged I2C byte, and a 1-Wire reset
+	// that drew a presence pulse.
+	Ack bool
+
+	// Err holds any error detected while decoding the frame.
+	Err error
+}
+
+// String summarizes the frame on one line.
+func (f Frame) String() string {
+	s := fmt.Sprintf("%12v %-7s", f.Start, f.Kind)
+	switch f.Kind {
+	case "data", "write", "read":
+		s += fmt.Sprintf(" 0x%02x", f.Value)
+	case "word":
+		s += fmt.Sprintf(" mosi=0x%02x miso=0x%02x", f.Value, f.Read)
+	case "address":
+		dir := "write"
+		if f.Value&1 != 0 {
+			dir = "read"
+		}
+		s += fmt.Sprintf(" 0x%02x %s", f.Value>>1, dir)
+	case "reset":
+		if f.Ack {
+			s += " presence"
+		} else {
+			s += " no presence"
+		}
+	}
+	if f.Kind == "address" || f.Kind == "write" || f.Kind == "read" {
+		if f.Ack {
+			s += " ack"
+		} else {
+			s += " nack"
+		}
+	}
+	if f.Err != nil {
+		s += fmt.Sprintf(" (%v)", f.Err)
+	}
+	return s
+}
+
+// Parity selects the parity bit of a UART character.
+type Parity int
+
+// These are the supported UART parity settings.
+const (
+	ParityNone Parity = iota
+	ParityEven
+	ParityOdd
+)
+
+// UARTConfig holds the line settings of a UART. The zero values of
+// Bits and StopBits default to 8 and 1.
+type UARTConfig struct {
+	Baud     int
+	Bits     int
+	Parity   Parity
+	StopBits int
+}
+
+// defaults returns the config with defaults applied.
+func (c UARTConfig) defaults() UARTConfig {
+	if c.Bits == 0 {
+		c.Bits = 8
+	}
+	if c.StopBits == 0 {
+		c.StopBits = 1
+	}
+	return c
+}
+
+// DecodeUART decodes the characters received on rx, an idle high UART
+// line, into "data" frames. Characters with a bad stop bit report
+// ErrFraming and those with a bad parity bit report ErrParity.
+func DecodeUART(rx Signal, cfg UARTConfig) []Frame {
+	cfg = cfg.defaults()
+	if cfg.Baud <= 0 {
+		return nil
+	}
+	bit := float64(time.Second) / float64(cfg.Baud)
+	at := func(t0 time.Duration, n float64) time.Duration {
+		return t0 + time.Duration(n*bit)
+	}
+	sample := func(t time.Duration) bool {
+		on, _ := rx.At(t)
+		return on
+	}
+	var frames []Frame
+	var next time.Duration
+	for i := 1; i < len(rx); i++ {
+		t0 := rx[i].At
+		if rx[i].On || (len(frames) != 0 && t0 < next) {
+			continue
+		}
+		if sample(at(t0, 0.5)) {
+			// Too short to be a start bit.
+			continue
+		}
+		f := Frame{Start: t0, Kind: "data"}
+		for b := 0; b < cfg.Bits; b++ {
+			if sample(at(t0, 1.5+float64(b))) {
+				f.Value |= 1 << b
+			}
+		}
+		n := 1 + cfg.Bits
+		if cfg.Parity != ParityNone {
+			ones := bits.OnesCount64(f.Value)
+			if sample(at(t0, 0.5+float64(n))) {
+				ones++
+			}
+			if (ones%2 == 0) != (cfg.Parity == ParityEven) {
+				f.Err = ErrParity
+			}
+			n++
+		}
+		for s := 0; s < cfg.StopBits; s++ {
+			if !sample(at(t0, 0.5+float64(n+s))) {
+				f.Err = ErrFraming
+			}
+		}
+		f.End = at(t0, float64(n+cfg.StopBits))
+		next = at(t0, float64(n+cfg.StopBits)-0.5)
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// SPIConfig holds the settings of an SPI bus. Mode is the SPI mode,
+// 0 to 3, combining the clock polarity (CPOL, Mode>>1) and phase
+// (CPHA, Mode&1). The zero value of Bits defaults to 8.
+type SPIConfig struct {
+	Mode     int
+	LSBFirst bool
+	Bits     int
+}
+
+// DecodeSPI decodes the words exchanged over an SPI bus into "word"
+// frames. The miso and cs (active low chip select) signals are
+// optional. A word cut short by the deselection of cs reports
+// ErrIncomplete.
+func DecodeSPI(sclk, mosi, miso, cs Signal, cfg SPIConfig) []Frame {
+	if cfg.Bits == 0 {
+		cfg.Bits = 8
+	}
+	// Data is sampled on the rising clock edge for modes 0 and 3,
+	// and on the falling edge for modes 1 and 2.
+	rising := cfg.Mode == 0 || cfg.Mode == 3
+	selected := len(cs) == 0 || !cs[0].On
+	var frames []Frame
+	var f Frame
+	n := 0
+	for _, e := range edges(sclk, cs) {
+		if e.signal == 1 {
+			if !e.on {
+				selected, n = true, 0
+			} else {
+				if n != 0 {
+					f.End, f.Err = e.at, ErrIncomplete
+					frames = append(frames, f)
+				}
+				selected, n = false, 0
+			}
+			continue
+		}
+		if !selected || e.on != rising {
+			continue
+		}
+		if n == 0 {
+			f = Frame{Start: e.at, Kind: "word"}
+		}
+		out, _ := mosi.At(e.at)
+		in, _ := miso.At(e.at)
+		pos := n
+		if !cfg.LSBFirst {
+			pos = cfg.Bits - 1 - n
+		}
+		if out {
+			f.Value |= 1 << pos
+		}
+		if in {
+			f.Read |= 1 << pos
+		}
+		if n++; n == cfg.Bits {
+			f.End = e.at
+			frames = append(frames, f)
+			n = 0
+		}
+	}
+	return frames
+}
+
+// DecodeI2C decodes the traffic of an I2C bus into frames. The "start",
+// "restart" and "stop" frames mark bus conditions, the first byte
+// after a start or restart is an "address" frame and subsequent bytes
+// are "write" or "read" frames, according to the direction bit of the
+// address. A byte interrupted by a bus condition reports
+// ErrIncomplete.
+func DecodeI2C(scl, sda Signal) []Frame {
+	var frames []Frame
+	var f Frame
+	active, address, read := false, false, false
+	n := 0
+	// A bit sampled on the rising edge of scl is only committed on
+	// the falling edge, since a start or stop condition may
+	// intervene.
+	var pending, data bool
+	var rise time.Duration
+	for _, e := range edges(scl, sda) {
+		if e.signal == 1 {
+			if clk, _ := scl.At(e.at); !clk {
+				continue
+			}
+			pending = false
+			if n != 0 {
+				f.End, f.Err = e.at, ErrIncomplete
+				frames = append(frames, f)
+			}
+			n = 0
+			switch {
+			case !e.on:
+				kind := "start"
+				if active {
+					kind = "restart"
+				}
+				frames = append(frames, Frame{Start: e.at, End: e.at, Kind: kind})
+				active, address = true, true
+			case active:
+				frames = append(frames, Frame{Start: e.at, End: e.at, Kind: "stop"})
+				active = false
+			}
+			continue
+		}
+		if !active {
+			continue
+		}
+		if e.on {
+			pending, rise = true, e.at
+			data, _ = sda.At(e.at)
+			continue
+		}
+		if !pending {
+			continue
+		}
+		pending = false
+		if n == 0 {
+			f = Frame{Start: rise, Kind: "write"}
+			if address {
+				f.Kind = "address"
+			} else if read {
+				f.Kind = "read"
+			}
+		}
+		if n < 8 {
+			f.Value <<= 1
+			if data {
+				f.Value |= 1
+			}
+			n++
+			continue
+		}
+		f.End, f.Ack = e.at, !data
+		frames = append(frames, f)
+		if address {
+			read = f.Value&1 != 0
+		}
+		n, address = 0, false
+	}
+	return frames
+}
+
+// These are the 1-Wire timing thresholds used by DecodeOneWire.
+const (
+	// oneWireReset is the minimum duration of a reset pulse.
+	oneWireReset = 300 * time.Microsecond
+	// oneWirePresence is the latest start of a presence pulse
+	// after the end of a reset pulse.
+	oneWirePresence = 100 * time.Microsecond
+	// oneWireZero is the minimum low duration of a zero bit.
+	oneWireZero = 15 * time.Microsecond
+)
+
+// DecodeOneWire decodes the traffic of a 1-Wire bus into "reset" and
+// "data" frames. Bytes are assembled, least significant bit first,
+// from the bit slots between resets. A byte cut short by a reset
+// reports ErrIncomplete.
+func DecodeOneWire(dq Signal) []Frame {
+	var frames []Frame
+	var f Frame
+	n := 0
+	reset := -1
+	for _, p := range dq.pulses(false) {
+		d := p.end - p.start
+		if reset >= 0 {
+			r := &frames[reset]
+			reset = -1
+			if p.start-r.End <= oneWirePresence && d < oneWireReset {
+				r.Ack, r.End = true, p.end
+				continue
+			}
+		}
+		if d >= oneWireReset {
+			if n != 0 {
+				f.End, f.Err = p.start, ErrIncomplete
+				frames = append(frames, f)
+			}
+			n = 0
+			frames = append(frames, Frame{Start: p.start, End: p.end, Kind: "reset"})
+			reset = len(frames) - 1
+			continue
+		}
+		if n == 0 {
+			f = Frame{Start: p.start, Kind: "data"}
+		}
+		if d < oneWireZero {
+			f.Value |= 1 << n
+		}
+		if n++; n == 8 {
+			f.End = p.end
+			frames = append(frames, f)
+			n = 0
+		}
+	}
+	return frames
+}
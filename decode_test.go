@@ -0,0 +1,151 @@
+package gpio
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wave converts a pattern of '0' and '1' characters, each lasting
+// step, into a Signal.
+func wave(step time.Duration, pattern string) Signal {
+	var s Signal
+	for i, c := range pattern {
+		s = s.add(time.Duration(i)*step, c == '1')
+	}
+	return s
+}
+
+// frameText summarizes frames without their times.
+func frameText(frames []Frame) string {
+	var parts []string
+	for _, f := range frames {
+		parts = append(parts, strings.Join(strings.Fields(f.String())[1:], " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func TestDecodeUART(t *testing.T) {
+	const baud = 9600
+	step := time.Second / baud
+	// 'A' (0x41), then 'z' (0x7a) with a low stop bit, then 'B'
+	// (0x42) with even parity.
+	s := wave(step, "11"+"0100000101"+"11"+"0010111100"+"1111")
+	frames := DecodeUART(s, UARTConfig{Baud: baud})
+	if got, want := frameText(frames), "data 0x41; data 0x7a (framing error)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(frames) != 0 && frames[0].Start != 2*step {
+		t.Errorf("first frame starts at %v, want %v", frames[0].Start, 2*step)
+	}
+	s = wave(step, "1"+"00100001001"+"1"+"00100001011"+"1")
+	frames = DecodeUART(s, UARTConfig{Baud: baud, Parity: ParityEven})
+	if got, want := frameText(frames), "data 0x42; data 0x42 (parity error)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDecodeSPI(t *testing.T) {
+	// Mode 0, MSB first: data changes while the clock is low and
+	// is sampled on the rising edge.
+	var sclk, mosi, miso, cs strings.Builder
+	cs.WriteString("11")
+	sclk.WriteString("00")
+	mosi.WriteString("00")
+	miso.WriteString("00")
+	for _, w := range [][2]byte{{0xa5, 0x3c}, {0x01, 0xff}} {
+		for i := 7; i >= 0; i-- {
+			o, in := "0", "0"
+			if w[0]>>i&1 != 0 {
+				o = "1"
+			}
+			if w[1]>>i&1 != 0 {
+				in = "1"
+			}
+			cs.WriteString("00")
+			sclk.WriteString("01")
+			mosi.WriteString(o + o)
+			miso.WriteString(in + in)
+		}
+	}
+	// A partial word before deselection.
+	cs.WriteString("00001")
+	sclk.WriteString("01010")
+	mosi.WriteString("11110")
+	miso.WriteString("00000")
+	step := time.Microsecond
+	frames := DecodeSPI(wave(step, sclk.String()), wave(step, mosi.String()), wave(step, miso.String()), wave(step, cs.String()), SPIConfig{})
+	if got, want := frameText(frames), "word mosi=0xa5 miso=0x3c; word mosi=0x01 miso=0xff; word mosi=0xc0 miso=0x00 (incomplete frame)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	frames = DecodeSPI(wave(step, sclk.String()), wave(step, mosi.String()), nil, nil, SPIConfig{LSBFirst: true, Bits: 16})
+	if got, want := frameText(frames), fmt.Sprintf("word mosi=0x%02x miso=0x00", 0x80a5); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDecodeI2C(t *testing.T) {
+	var scl, sda strings.Builder
+	put := func(c, d string) {
+		scl.WriteString(c)
+		sda.WriteString(d)
+	}
+	bit := func(on bool) {
+		d := "0"
+		if on {
+			d = "1"
+		}
+		put("0110", d+d+d+d)
+	}
+	byteAck := func(b byte, ack bool) {
+		for i := 7; i >= 0; i-- {
+			bit(b>>i&1 != 0)
+		}
+		bit(!ack)
+	}
+	put("11", "11")
+	put("10", "00") // start
+	byteAck(0x50<<1, true)
+	byteAck(0x10, true)
+	put("0111", "1110") // restart
+	byteAck(0x50<<1|1, true)
+	byteAck(0xab, false)
+	put("0111", "0001") // stop
+	step := time.Microsecond
+	frames := DecodeI2C(wave(step, scl.String()), wave(step, sda.String()))
+	want := "start; address 0x50 write ack; write 0x10 ack; restart; address 0x50 read ack; read 0xab nack; stop"
+	if got := frameText(frames); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDecodeOneWire(t *testing.T) {
+	us := time.Microsecond
+	var s Signal
+	at := time.Duration(0)
+	low := func(d, gap time.Duration) {
+		s = s.add(at, true)
+		s = s.add(at+10*us, false)
+		s = s.add(at+10*us+d, true)
+		at += 10*us + d + gap
+	}
+	low(480*us, 30*us)  // reset
+	low(110*us, 300*us) // presence
+	for _, b := range []byte{0xcc, 0x44} {
+		for i := 0; i < 8; i++ {
+			if b>>i&1 != 0 {
+				low(6*us, 60*us)
+			} else {
+				low(60*us, 10*us)
+			}
+		}
+	}
+	low(6*us, 60*us)
+	low(480*us, 500*us) // reset without presence
+	s = s.add(at, true)
+	frames := DecodeOneWire(s)
+	if got, want := frameText(frames), "reset presence; data 0xcc; data 0x44; data 0x01 (incomplete frame); reset no presence"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package gpio
+
+import (
+	"sync"
+	"time"
+)
+
+// Flusher is implemented by tracers that buffer samples. The Bank
+// flushes such a tracer when it is closed.
+type Flusher interface {
+	// Flush blocks until all buffered samples have been delivered.
+	Flush() error
+}
+
+// Overflow selects how a Dispatcher handles a sample when its queue
+// is full.
+type Overflow int
+
+const (
+	// OverflowBlock blocks the traced source until the queue has
+	// room for the sample.
+	OverflowBlock Overflow = iota
+
+	// OverflowDropOldest discards the oldest queued sample to make
+	// room for the new one.
+	OverflowDropOldest
+
+	// OverflowDropNewest discards the new sample.
+	OverflowDropNewest
+)
+
+// These are the kinds of item queued by a Dispatcher.
+const (
+	dispatchSample = iota
+	dispatchNum
+	dispatchLabel
+	dispatchNote
+)
+
+// dispatched holds a queued sample, label or annotation. The text of
+// an annotation is held in label.
+type dispatched struct {
+	kind        int
+	when        time.Time
+	src         Named
+	index       int
+	mask, value uint64
+	n           int64
+	label       string
+}
+
+// Dispatcher is a TimedTracer (and TimedNumTracer) that queues
+// samples and delivers them to a target tracer from a separate
+// goroutine. This keeps a slow target from stalling the Get/Set calls
+// of the traced source.
+type Dispatcher struct {
+	target TimedTracer
+	nums   TimedNumTracer
+	policy Overflow
+
+	// mu protects all subsequent fields. cond is signaled when any
+	// of them change.
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// queue holds up to depth undelivered samples. busy is true
+	// while a sample, already removed from queue, is being
+	// delivered.
+	queue []dispatched
+	depth int
+	busy  bool
+
+	// dropped counts the samples discarded because of overflow or
+	// because they arrived after Close().
+	dropped uint64
+
+	// closed indicates Close() has been called and done is closed
+	// once the delivery goroutine has exited.
+	closed bool
+	done   chan struct{}
+}
+
+// NewDispatcher returns a Dispatcher that queues up to depth samples
+// for delivery to target. The policy determines how a full queue is
+// handled. If target also implements TimedNumTracer, the Dispatcher
+// delivers Vector values to it too.
+func NewDispatcher(target TimedTracer, depth int, policy Overflow) *Dispatcher {
+	if depth < 1 {
+		depth = 1
+	}
+	d := &Dispatcher{
+		target: target,
+		policy: policy,
+		depth:  depth,
+		done:   make(chan struct{}),
+	}
+	d.nums, _ = target.(TimedNumTracer)
+	d.cond = sync.NewCond(&d.mu)
+	go d.deliver()
+	return d
+}
+
+// deliver forwards queued samples to the target tracer.
+func (d *Dispatcher) deliver() {
+	defer close(d.done)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.queue) == 0 {
+			return
+		}
+		s := d.queue[0]
+		d.queue = d.queue[1:]
+		d.busy = true
+		d.mu.Unlock()
+		switch s.kind {
+		case dispatchSample:
+			if d.target != nil {
+				d.target.TimedSample(s.when, s.src, s.mask, s.value)
+			}
+		case dispatchNum:
+			if d.nums != nil {
+				d.nums.TimedSampleNum(s.when, s.src, s.index, s.n)
+			}
+		case dispatchLabel:
+			switch l := d.target.(type) {
+			case SourceLabeler:
+				l.LabelLine(s.src, s.index, s.label)
+			case Labeler:
+				l.Label(s.index, s.label)
+			}
+		case dispatchNote:
+			if a, ok := d.target.(Annotator); ok {
+				a.Annotate(s.when, s.src, s.label)
+			}
+		}
+		d.mu.Lock()
+		d.busy = false
+		d.cond.Broadcast()
+	}
+}
+
+// enqueue queues a sample according to the overflow policy.
+func (d *Dispatcher) enqueue(s dispatched) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for !d.closed && len(d.queue) >= d.depth {
+		switch d.policy {
+		case OverflowDropNewest:
+			d.dropped++
+			return
+		case OverflowDropOldest:
+			d.queue = d.queue[1:]
+			d.dropped++
+			continue
+		}
+		d.cond.Wait()
+	}
+	if d.closed {
+		d.dropped++
+		return
+	}
+	d.queue = append(d.queue, s)
+	d.cond.Broadcast()
+}
+
+// TimedSample queues a sample for delivery to the target tracer.
+func (d *Dispatcher) TimedSample(when time.Time, src Named, mask, value uint64) {
+	d.enqueue(dispatched{when: when, src: src, mask: mask, value: value})
+}
+
+// TimedSampleNum queues a Vector value for delivery to the target
+// tracer.
+func (d *Dispatcher) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	d.enqueue(dispatched{kind: dispatchNum, when: when, src: src, index: index, n: value})
+}
+
+// LabelLine queues a line label for delivery to the target tracer, if
+// it accepts labels.
+func (d *Dispatcher) LabelLine(src Named, index int, label string) error {
+	d.enqueue(dispatched{kind: dispatchLabel, src: src, index: index, label: label})
+	return nil
+}
+
+// Annotate queues an annotation for delivery to the target tracer, if
+// it is an Annotator.
+func (d *Dispatcher) Annotate(when time.Time, src Named, text string) {
+	d.enqueue(dispatched{kind: dispatchNote, when: when, src: src, label: text})
+}
+
+// Dropped returns the number of samples discarded so far.
+func (d *Dispatcher) Dropped() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dropped
+}
+
+// Flush blocks until all of the queued samples have been delivered.
+func (d *Dispatcher) Flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.queue) != 0 || d.busy {
+		d.cond.Wait()
+	}
+	return nil
+}
+
+// Close flushes the queued samples and stops the delivery goroutine.
+// Samples received after Close() are dropped. If the target tracer is
+// a Flusher, it is flushed too.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	d.cond.Broadcast()
+	d.mu.Unlock()
+	<-d.done
+	if f, ok := d.target.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package gpio
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowTracer records the values of the samples it is sent, slowly.
+type slowTracer struct {
+	mu     sync.Mutex
+	gate   chan struct{}
+	values []uint64
+}
+
+func (s *slowTracer) TimedSample(when time.Time, src Named, mask, value uint64) {
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = append(s.values, value)
+}
+
+func TestDispatcher(t *testing.T) {
+	for _, test := range []struct {
+		policy  Overflow
+		dropped uint64
+		want    []uint64
+	}{
+		{policy: OverflowBlock, want: []uint64{0, 1, 2, 3, 4, 5}},
+		{policy: OverflowDropOldest, dropped: 3, want: []uint64{0, 4, 5}},
+		{policy: OverflowDropNewest, dropped: 3, want: []uint64{0, 1, 2}},
+	} {
+		s := &slowTracer{gate: make(chan struct{})}
+		d := NewDispatcher(s, 2, test.policy)
+		d.TimedSample(time.Now(), nil, 1, 0)
+		// Wait for the first sample to be in delivery.
+		for {
+			d.mu.Lock()
+			busy := d.busy
+			d.mu.Unlock()
+			if busy {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if test.policy == OverflowBlock {
+			close(s.gate)
+		}
+		for i := uint64(1); i < 6; i++ {
+			d.TimedSample(time.Now(), nil, 1, i)
+		}
+		if test.policy != OverflowBlock {
+			close(s.gate)
+		}
+		if err := d.Close(); err != nil {
+			t.Fatalf("%d: close failed: %v", test.policy, err)
+		}
+		if got := d.Dropped(); got != test.dropped {
+			t.Errorf("%d: dropped got=%d want=%d", test.policy, got, test.dropped)
+		}
+		if len(s.values) != len(test.want) {
+			t.Fatalf("%d: got=%v want=%v", test.policy, s.values, test.want)
+		}
+		for i, v := range test.want {
+			if s.values[i] != v {
+				t.Errorf("%d: got=%v want=%v", test.policy, s.values, test.want)
+				break
+			}
+		}
+	}
+}
+
+// labelReader is a tracer that reads the bank label of each sampled
+// line, so delivering a sample needs the bank lock.
+type labelReader struct {
+	gate   chan struct{}
+	labels []string
+}
+
+func (r *labelReader) TimedSample(when time.Time, src Named, mask, value uint64) {
+	<-r.gate
+	if b, ok := src.(*Bank); ok {
+		r.labels = append(r.labels, b.LineLabel(1))
+	}
+}
+
+func TestBankCloseDispatcher(t *testing.T) {
+	b := &Bank{name: "chip", lines: 8}
+	r := &labelReader{gate: make(chan struct{})}
+	d := NewDispatcher(r, 4, OverflowBlock)
+	b.SetTimedTracer(d)
+	d.TimedSample(time.Now(), b, 2, 2)
+
+	done := make(chan error)
+	go func() {
+		done <- b.Close()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(r.gate)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close deadlocked flushing the dispatcher")
+	}
+	if len(r.labels) != 1 || r.labels[0] != "chip_1" {
+		t.Errorf("got labels %q, want [\"chip_1\"]", r.labels)
+	}
+}
@@ -0,0 +1,219 @@
+package gpio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Edge is a timestamped transition of a watched line.
+type Edge struct {
+	// When is the time of the transition.
+	When time.Time
+
+	// Index is the line that changed.
+	Index int
+
+	// On is the new value of the line.
+	On bool
+}
+
+// Watcher is implemented by sources that can deliver the transitions
+// of a line as they happen, which is more precise than polling it
+// with Get().
+type Watcher interface {
+	// Watch returns a channel over which the transitions of the
+	// indexed line are delivered until ctx is done, at which point
+	// the channel is closed.
+	Watch(ctx context.Context, index int) (<-chan Edge, error)
+}
+
+// Compile time confirmation that the Watcher interface is satisfied.
+var (
+	_ Watcher = (*Bank)(nil)
+	_ Watcher = (*Flag)(nil)
+)
+
+// edgeDepth is the number of undelivered edges a watch channel holds.
+// Further edges are dropped until the receiver catches up.
+const edgeDepth = 1024
+
+// edgeFlags are the flags added to watched input lines.
+const edgeFlags = LineFlagEdgeRising | LineFlagEdgeFalling | LineFlagEventClockRealtime
+
+// These are the kernel ABI values of gpio_v2_line_event.id.
+const (
+	lineEventRisingEdge  = 1
+	lineEventFallingEdge = 2
+)
+
+// lineEvent holds the kernel ABI object 'struct gpio_v2_line_event'.
+type lineEvent struct {
+	Timestamp        uint64
+	ID               uint32
+	Offset           uint32
+	Seqno, LineSeqno uint32
+	Padding          [6]uint32
+}
+
+// lineEventSize is the size of a lineEvent read from the kernel.
+var lineEventSize = binary.Size(lineEvent{})
+
+// Watch arranges for the kernel to detect the transitions of input
+// line g and delivers them, with kernel timestamps, over the returned
+// channel until ctx is done. The transitions also update the cached
+// input values of the bank, and are traced with their precise times.
+// Only one watch per line is supported, and edges are dropped if the
+// channel is not drained promptly.
+func (b *Bank) Watch(ctx context.Context, g int) (<-chan Edge, error) {
+	if err := b.valid(g); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.insMask&(uint64(1)<<g) == 0 {
+		return nil, fmt.Errorf("%d is not an enabled input in %q bank", g, b.name)
+	}
+	if _, ok := b.edges[g]; ok {
+		return nil, fmt.Errorf("%d is already watched in %q bank", g, b.name)
+	}
+	if b.edges == nil {
+		b.edges = make(map[int]chan Edge)
+	}
+	ch := make(chan Edge, edgeDepth)
+	b.edges[g] = ch
+	if err := b.enableRWLocked(); err != nil {
+		delete(b.edges, g)
+		return nil, err
+	}
+	if !b.edgeReader {
+		b.edgeReader = true
+		go b.readEdges()
+	}
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.edges[g] != ch {
+			return
+		}
+		delete(b.edges, g)
+		close(ch)
+		if b.f != nil {
+			b.enableRWLocked()
+		}
+	}()
+	return ch, nil
+}
+
+// readEdges reads the line events of watched inputs until no lines are
+// watched or the bank is closed.
+func (b *Bank) readEdges() {
+	buf := make([]byte, 16*lineEventSize)
+	for {
+		b.mu.Lock()
+		f := b.insF
+		if b.f == nil || len(b.edges) == 0 {
+			for g, ch := range b.edges {
+				delete(b.edges, g)
+				close(ch)
+			}
+			b.edgeReader = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+		if f == nil {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		n, err := f.Read(buf)
+		if err != nil {
+			// A closed file indicates the input request was
+			// replaced, but avoid spinning on other errors.
+			if !errors.Is(err, os.ErrClosed) {
+				time.Sleep(time.Millisecond)
+			}
+			continue
+		}
+		b.mu.Lock()
+		r := bytes.NewReader(buf[:n])
+		for r.Len() >= lineEventSize {
+			var ev lineEvent
+			if err := binary.Read(r, localEndianness, &ev); err != nil {
+				break
+			}
+			b.edgeLocked(ev)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// edgeLocked applies a line event to the cached inputs and delivers it
+// to the line watcher.
+func (b *Bank) edgeLocked(ev lineEvent) {
+	g := int(ev.Offset)
+	bit := uint64(1) << g
+	if b.insMask&bit == 0 {
+		return
+	}
+	e := Edge{
+		When:  time.Unix(0, int64(ev.Timestamp)),
+		Index: g,
+		On:    ev.ID == lineEventRisingEdge,
+	}
+	if on := b.ins&bit != 0; on != e.On {
+		b.ins ^= bit
+		b.insWhen = e.When
+		if b.tracer != nil {
+			b.tracer.TimedSample(e.When, b, b.insMask|b.outsMask, b.ins|b.outs)
+		}
+	}
+	if ch, ok := b.edges[g]; ok {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Watch delivers the transitions of the indexed flag over the returned
+// channel until ctx is done. Only one watch per flag is supported, and
+// edges are dropped if the channel is not drained promptly.
+func (f *Flag) Watch(ctx context.Context, index int) (<-chan Edge, error) {
+	if err := f.valid(index); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.edges[index]; ok {
+		return nil, fmt.Errorf("flag %d is already watched", index)
+	}
+	if f.edges == nil {
+		f.edges = make(map[int]chan Edge)
+	}
+	ch := make(chan Edge, edgeDepth)
+	f.edges[index] = ch
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.edges, index)
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// edgeLocked delivers a transition of the indexed flag to its watcher.
+func (f *Flag) edgeLocked(when time.Time, index int, on bool) {
+	if ch, ok := f.edges[index]; ok {
+		select {
+		case ch <- Edge{When: when, Index: index, On: on}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EncoderMode selects which transitions of a quadrature encoder are
+// counted.
+type EncoderMode int
+
+// These are the counting modes, by counts per quadrature cycle.
+const (
+	// EncoderX1 counts once per cycle.
+	EncoderX1 EncoderMode = 1
+	// EncoderX2 counts twice per cycle.
+	EncoderX2 EncoderMode = 2
+	// EncoderX4 counts every transition of both lines.
+	EncoderX4 EncoderMode = 4
+)
+
+// EncoderOverflow selects what happens when an encoder count passes
+// the end of its range.
+type EncoderOverflow int
+
+const (
+	// EncoderWrap continues the count from the other end of the
+	// range.
+	EncoderWrap EncoderOverflow = iota
+	// EncoderSaturate holds the count at the end of the range.
+	EncoderSaturate
+)
+
+// EncoderConfig holds the settings of a quadrature encoder decoder.
+// The zero value counts every transition (EncoderX4), over the whole
+// int64 range (wrapping), without debouncing or velocity estimation.
+type EncoderConfig struct {
+	Mode EncoderMode
+
+	// Debounce, if non-zero, is how long a line must hold a new
+	// level for the transition to be accepted. Shorter pulses are
+	// discarded as bounce.
+	Debounce time.Duration
+
+	// Min and Max are the range of the count. When both are zero
+	// the range is that of int64.
+	Min, Max int64
+	Overflow EncoderOverflow
+
+	// Window, if non-zero, enables velocity estimation over the
+	// counts made within this much time of the most recent.
+	Window time.Duration
+}
+
+// Encoder decodes a quadrature rotary encoder wired to two watched
+// input lines, A and B, and writes the count into an indexed value.
+// The count increases when A leads B. Transitions are processed in
+// timestamp order, so the direction is reliable at high speeds.
+type Encoder struct {
+	cfg      EncoderConfig
+	v        IO[int64]
+	index    int
+	min, max int64
+
+	// clock, if non-nil, replaces the real time.
+	clock clock
+
+	// lines holds the accepted and pending states of A and B. It is
+	// only accessed by the decoding goroutine.
+	lines [2]encoderLine
+
+	// mu protects all subsequent fields.
+	mu sync.Mutex
+
+	// sub counts the transitions within the current count, and pos
+	// is the count without overflow, used for velocity.
+	count, pos int64
+	sub        int
+	history    []encoderStep
+	errors     uint64
+	err        error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// encoderLine holds the state of one encoder line. If pending is set,
+// the line changed level at pendAt and is waiting to be debounced.
+type encoderLine struct {
+	level   bool
+	pending bool
+	pendAt  time.Time
+}
+
+// encoderStep records the count (without overflow) at a time.
+type encoderStep struct {
+	at  time.Time
+	pos int64
+}
+
+// encoderPhase numbers the quadrature states, indexed by A<<1|B, in the
+// order they occur when A leads B.
+var encoderPhase = [4]int{0, 3, 1, 2}
+
+// NewEncoder decodes the encoder on lines a and b of io, which must be
+// a Watcher, and writes the count to v at index. The count starts from
+// the current value of v. Decoding continues until ctx is done or
+// Close() is called.
+func NewEncoder(ctx context.Context, io IO[bool], a, b int, v IO[int64], index int, cfg EncoderConfig) (*Encoder, error) {
+	if cfg.Mode == 0 {
+		cfg.Mode = EncoderX4
+	}
+	if cfg.Mode != EncoderX1 && cfg.Mode != EncoderX2 && cfg.Mode != EncoderX4 {
+		return nil, fmt.Errorf("invalid encoder mode %d", cfg.Mode)
+	}
+	if cfg.Overflow != EncoderWrap && cfg.Overflow != EncoderSaturate {
+		return nil, fmt.Errorf("invalid encoder overflow %d", cfg.Overflow)
+	}
+	if cfg.Debounce < 0 || cfg.Window < 0 {
+		return nil, fmt.Errorf("invalid encoder timing debounce=%v window=%v", cfg.Debounce, cfg.Window)
+	}
+	e := &Encoder{
+		cfg:   cfg,
+		v:     v,
+		index: index,
+		min:   cfg.Min,
+		max:   cfg.Max,
+		done:  make(chan struct{}),
+	}
+	if e.min == 0 && e.max == 0 {
+		e.min, e.max = math.MinInt64, math.MaxInt64
+	} else if e.min >= e.max {
+		return nil, fmt.Errorf("invalid encoder range [%d,%d]", cfg.Min, cfg.Max)
+	}
+	count, err := v.Get(index)
+	if err != nil {
+		return nil, err
+	}
+	if count < e.min || count > e.max {
+		return nil, fmt.Errorf("encoder count %d is outside [%d,%d]", count, e.min, e.max)
+	}
+	e.count = count
+	wt, ok := io.(Watcher)
+	if !ok {
+		return nil, fmt.Errorf("encoder lines cannot be watched")
+	}
+	ctx, e.cancel = context.WithCancel(ctx)
+	var edges [2]<-chan Edge
+	for i, g := range []int{a, b} {
+		if edges[i], err = wt.Watch(ctx, g); err != nil {
+			e.cancel()
+			return nil, err
+		}
+		if e.lines[i].level, err = io.Get(g); err != nil {
+			e.cancel()
+			return nil, err
+		}
+	}
+	go e.run(edges)
+	return e, nil
+}
+
+// Close stops decoding, once the edges already delivered have been
+// decoded, and returns the first error encountered while writing the
+// count.
+func (e *Encoder) Close() error {
+	e.cancel()
+	<-e.done
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Count returns the current count.
+func (e *Encoder) Count() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.count
+}
+
+// Errors returns the number of illegal transitions seen. These are
+// edges that do not change the level of their line, which indicate
+// that an edge was missed.
+func (e *Encoder) Errors() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.errors
+}
+
+// Velocity returns an estimate, in counts per second, of the rate of
+// the counts made within the configured Window of the most recent.
+// The estimate is zero if velocity estimation is not enabled, or no
+// count has been made within the last Window.
+func (e *Encoder) Velocity() float64 {
+	now := time.Now()
+	if e.clock != nil {
+		now = e.clock.now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := len(e.history)
+	if n < 2 || now.Sub(e.history[n-1].at) > e.cfg.Window {
+		return 0
+	}
+	first, last := e.history[0], e.history[n-1]
+	return float64(last.pos-first.pos) / last.at.Sub(first.at).Seconds()
+}
+
+// run decodes the edges of the two lines until both are closed. The
+// lines are then taken to have held their levels until now.
+func (e *Encoder) run(edges [2]<-chan Edge) {
+	defer close(e.done)
+	defer func() { e.settle(time.Now()) }()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var batch []encoderEdge
+	for edges[0] != nil || edges[1] != nil {
+		var settle <-chan time.Time
+		if at, ok := e.settleAt(); ok {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(at))
+			settle = timer.C
+		}
+		batch = batch[:0]
+		select {
+		case ed, ok := <-edges[0]:
+			batch = e.received(batch, &edges[0], 0, ed, ok)
+		case ed, ok := <-edges[1]:
+			batch = e.received(batch, &edges[1], 1, ed, ok)
+		case <-settle:
+			e.settle(time.Now())
+			continue
+		}
+		// Edges are delivered to each line separately, so gather
+		// all of those pending to process them in order.
+		for more := true; more; {
+			more = false
+			for i := range edges {
+				select {
+				case ed, ok := <-edges[i]:
+					batch, more = e.received(batch, &edges[i], i, ed, ok), true
+				default:
+				}
+			}
+		}
+		sort.SliceStable(batch, func(i, j int) bool { return batch[i].When.Before(batch[j].When) })
+		for _, ed := range batch {
+			e.edge(ed.line, ed.Edge)
+		}
+	}
+}
+
+// encoderEdge is an edge of encoder line A (0) or B (1).
+type encoderEdge struct {
+	Edge
+	line int
+}
+
+// received adds a received edge to batch, or forgets ch once closed.
+func (e *Encoder) received(batch []encoderEdge, ch *<-chan Edge, line int, ed Edge, ok bool) []encoderEdge {
+	if !ok {
+		*ch = nil
+		return batch
+	}
+	return append(batch, encoderEdge{Edge: ed, line: line})
+}
+
+// settleAt returns the earliest time a pending transition is accepted.
+func (e *Encoder) settleAt() (time.Time, bool) {
+	var at time.Time
+	ok := false
+	for _, l := range e.lines {
+		if l.pending && (!ok || l.pendAt.Before(at)) {
+			at, ok = l.pendAt, true
+		}
+	}
+	return at.Add(e.cfg.Debounce), ok
+}
+
+// settle accepts the pending transitions that have been stable until
+// time t, in the order they happened.
+func (e *Encoder) settle(t time.Time) {
+	for {
+		at, ok := e.settleAt()
+		if !ok || at.After(t) {
+			return
+		}
+		i := 0
+		if l := e.lines[1]; l.pending && (!e.lines[0].pending || l.pendAt.Before(e.lines[0].pendAt)) {
+			i = 1
+		}
+		e.lines[i].pending = false
+		e.apply(i, !e.lines[i].level, e.lines[i].pendAt)
+	}
+}
+
+// edge processes an edge of line A (0) or B (1).
+func (e *Encoder) edge(i int, ed Edge) {
+	if e.cfg.Debounce == 0 {
+		e.apply(i, ed.On, ed.When)
+		return
+	}
+	e.settle(ed.When)
+	l := &e.lines[i]
+	switch {
+	case ed.On == l.level:
+		// A pulse shorter than the debounce time is bounce, and
+		// otherwise an edge was missed.
+		if !l.pending {
+			e.illegal()
+		}
+		l.pending = false
+	case l.pending:
+		// An edge back to the level of a pending transition
+		// was missed, so the line has only just settled.
+		e.illegal()
+		l.pendAt = ed.When
+	default:
+		l.pending, l.pendAt = true, ed.When
+	}
+}
+
+// illegal counts an illegal transition.
+func (e *Encoder) illegal() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errors++
+}
+
+// apply accepts a new level of line i at time when, counting the
+// resulting quadrature step.
+func (e *Encoder) apply(i int, on bool, when time.Time) {
+	if e.lines[i].level == on {
+		e.illegal()
+		return
+	}
+	state := func() int {
+		s := 0
+		for _, l := range e.lines {
+			s <<= 1
+			if l.level {
+				s |= 1
+			}
+		}
+		return s
+	}
+	was := encoderPhase[state()]
+	e.lines[i].level = on
+	d := 1
+	if (encoderPhase[state()]-was)&3 == 3 {
+		d = -1
+	}
+	e.step(d, when)
+}
+
+// step advances the count by a quarter cycle in direction d.
+func (e *Encoder) step(d int, when time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	div := int(EncoderX4 / e.cfg.Mode)
+	e.sub += d
+	switch {
+	case e.sub == div:
+		e.sub = 0
+	case e.sub < 0:
+		e.sub = div - 1
+	default:
+		return
+	}
+	e.pos += int64(d)
+	switch {
+	case d > 0 && e.count == e.max:
+		if e.cfg.Overflow == EncoderWrap {
+			e.count = e.min
+		}
+	case d < 0 && e.count == e.min:
+		if e.cfg.Overflow == EncoderWrap {
+			e.count = e.max
+		}
+	default:
+		e.count += int64(d)
+	}
+	if err := e.v.Set(e.index, e.count); err != nil && e.err == nil {
+		e.err = err
+	}
+	if e.cfg.Window == 0 {
+		return
+	}
+	e.history = append(e.history, encoderStep{at: when, pos: e.pos})
+	n := 0
+	for n < len(e.history) && when.Sub(e.history[n].at) > e.cfg.Window {
+		n++
+	}
+	e.history = append(e.history[:0], e.history[n:]...)
+}
@@ -0,0 +1,180 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// encoderWire simulates the two lines of a quadrature encoder. Its
+// edges are generated in advance and delivered as soon as the lines
+// are watched.
+type encoderWire struct {
+	at     time.Time
+	levels [2]bool
+	edges  [2][]Edge
+}
+
+func newEncoderWire() *encoderWire {
+	return &encoderWire{at: time.Now().Add(-time.Minute)}
+}
+
+func (w *encoderWire) Lines() int             { return 2 }
+func (w *encoderWire) Label(index int) string { return []string{"A", "B"}[index] }
+func (w *encoderWire) SetAlias(name string)   {}
+func (w *encoderWire) Set(index int, on bool) error {
+	return errors.New("not supported")
+}
+func (w *encoderWire) SetHold(index int) (chan<- bool, error) {
+	return nil, errors.New("not supported")
+}
+
+// Get returns the level of a line before any of the edges.
+func (w *encoderWire) Get(index int) (bool, error) {
+	return false, nil
+}
+
+func (w *encoderWire) Watch(ctx context.Context, index int) (<-chan Edge, error) {
+	ch := make(chan Edge, edgeDepth)
+	for _, e := range w.edges[index] {
+		ch <- e
+	}
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// toggle adds an edge of line i, dt after the previous one.
+func (w *encoderWire) toggle(i int, dt time.Duration) {
+	w.at = w.at.Add(dt)
+	w.levels[i] = !w.levels[i]
+	w.edges[i] = append(w.edges[i], Edge{When: w.at, Index: i, On: w.levels[i]})
+}
+
+// turn adds n quarter cycles, forwards for positive n, 1ms apart.
+func (w *encoderWire) turn(n int) {
+	for ; n > 0; n-- {
+		// Forwards, A changes to differ from B.
+		if w.levels[0] == w.levels[1] {
+			w.toggle(0, time.Millisecond)
+		} else {
+			w.toggle(1, time.Millisecond)
+		}
+	}
+	for ; n < 0; n++ {
+		if w.levels[0] == w.levels[1] {
+			w.toggle(1, time.Millisecond)
+		} else {
+			w.toggle(0, time.Millisecond)
+		}
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	for i, test := range []struct {
+		cfg   EncoderConfig
+		start int64
+		turns []int
+		want  int64
+	}{
+		{turns: []int{40, -3}, want: 37},
+		{cfg: EncoderConfig{Mode: EncoderX2}, turns: []int{40, -3}, want: 18},
+		{cfg: EncoderConfig{Mode: EncoderX1}, start: 5, turns: []int{40, -3}, want: 14},
+		{cfg: EncoderConfig{Mode: EncoderX1, Max: 9}, turns: []int{48}, want: 2},
+		{cfg: EncoderConfig{Mode: EncoderX1, Max: 9}, turns: []int{-4}, want: 9},
+		{cfg: EncoderConfig{Mode: EncoderX1, Max: 9, Overflow: EncoderSaturate}, turns: []int{48, -4}, want: 8},
+		{cfg: EncoderConfig{Min: -2, Max: 2, Overflow: EncoderSaturate}, turns: []int{-9}, want: -2},
+	} {
+		w := newEncoderWire()
+		for _, n := range test.turns {
+			w.turn(n)
+		}
+		v := NewVector(2)
+		v.Set(1, test.start)
+		e, err := NewEncoder(context.Background(), w, 0, 1, v, 1, test.cfg)
+		if err != nil {
+			t.Fatalf("test %d: NewEncoder failed: %v", i, err)
+		}
+		// The buffered edges are all decoded before Close returns.
+		if err := e.Close(); err != nil {
+			t.Errorf("test %d: Close failed: %v", i, err)
+		}
+		if got := e.Count(); got != test.want {
+			t.Errorf("test %d: got count %d, want %d", i, got, test.want)
+		}
+		if got, _ := v.Get(1); got != test.want {
+			t.Errorf("test %d: got vector value %d, want %d", i, got, test.want)
+		}
+		if n := e.Errors(); n != 0 {
+			t.Errorf("test %d: got %d errors", i, n)
+		}
+	}
+
+	v := NewVector(1)
+	v.Set(0, 20)
+	if _, err := NewEncoder(context.Background(), newEncoderWire(), 0, 1, v, 0, EncoderConfig{Max: 9}); err == nil {
+		t.Error("count outside the range accepted")
+	}
+	if _, err := NewEncoder(context.Background(), newEncoderWire(), 0, 1, v, 0, EncoderConfig{Mode: 3}); err == nil {
+		t.Error("invalid mode accepted")
+	}
+	if _, err := NewEncoder(context.Background(), newI2CSim(), 0, 1, v, 0, EncoderConfig{}); err == nil {
+		t.Error("unwatchable lines accepted")
+	}
+}
+
+func TestEncoderBounce(t *testing.T) {
+	w := newEncoderWire()
+	w.turn(2)
+	// A glitch on a stable line.
+	w.toggle(0, time.Millisecond)
+	w.toggle(0, 50*time.Microsecond)
+	// A transition that bounces.
+	w.toggle(0, time.Millisecond)
+	w.toggle(0, 20*time.Microsecond)
+	w.toggle(0, 20*time.Microsecond)
+	w.turn(5)
+	// A missed edge.
+	w.levels[1] = !w.levels[1]
+	w.toggle(1, time.Millisecond)
+	w.turn(-1)
+
+	v := NewVector(1)
+	e, err := NewEncoder(context.Background(), w, 0, 1, v, 0, EncoderConfig{Debounce: 200 * time.Microsecond})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	e.Close()
+	if got := e.Count(); got != 7 {
+		t.Errorf("got count %d, want 7", got)
+	}
+	if n := e.Errors(); n != 1 {
+		t.Errorf("got %d errors, want 1", n)
+	}
+}
+
+func TestEncoderVelocity(t *testing.T) {
+	w := newEncoderWire()
+	w.turn(-20)
+	v := NewVector(1)
+	e, err := NewEncoder(context.Background(), w, 0, 1, v, 0, EncoderConfig{Window: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	e.Close()
+	if got := e.Count(); got != -20 {
+		t.Errorf("got count %d, want -20", got)
+	}
+	c := &pwmClock{at: w.at}
+	e.clock = c
+	if got := e.Velocity(); got != -1000 {
+		t.Errorf("got velocity %v, want -1000", got)
+	}
+	c.at = w.at.Add(time.Second)
+	if got := e.Velocity(); got != 0 {
+		t.Errorf("got velocity %v after stopping, want 0", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"time"
 )
 
 // Flag is a 64 bit array of boolean flags initialized to all
@@ -11,12 +12,14 @@ import (
 // is expanded as references are made to its indices. This helps cut
 // down the size of generated traces if only one or two bits are used.
 type Flag struct {
+	seq    uint64
 	mu     sync.Mutex
 	alias  string
 	value  uint64
 	mask   uint64
 	setCh  chan bool
-	tracer Tracer
+	tracer TimedTracer
+	edges  map[int]chan Edge
 }
 
 // NewFlag returns a new bank of flags.
@@ -80,7 +83,7 @@ func (f *Flag) Get(index int) (bool, error) {
 	if f.mask&bit == 0 {
 		f.mask |= bit
 		if f.tracer != nil {
-			f.tracer.Sample(f.mask, f.value)
+			f.tracer.TimedSample(time.Now(), f, f.mask, f.value)
 		}
 	}
 	return f.value&bit != 0, nil
@@ -120,11 +123,13 @@ func (f *Flag) SetHold(index int) (chan<- bool, error) {
 					oldMask := f.mask
 					f.mask |= bit
 					old := f.value
+					now := time.Now()
 					if on != (old&bit != 0) {
 						f.value ^= bit
+						f.edgeLocked(now, index, on)
 					}
 					if f.tracer != nil && (old != f.value || oldMask != f.mask) {
-						f.tracer.Sample(f.mask, f.value)
+						f.tracer.TimedSample(now, f, f.mask, f.value)
 					}
 					// Block until channel closed.
 					for ok {
@@ -154,12 +159,28 @@ func (f *Flag) Set(index int, on bool) error {
 	return err
 }
 
+// Annotate records text in the timeline of the flag trace, if the
+// tracer is an Annotator.
+func (f *Flag) Annotate(text string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if a, ok := f.tracer.(Annotator); ok {
+		a.Annotate(time.Now(), f, text)
+	}
+}
+
 // SetTracer sets or clears (tracer = nil) the flag tracer function.
 func (f *Flag) SetTracer(tracer Tracer) {
+	f.SetTimedTracer(Timed(tracer))
+}
+
+// SetTimedTracer sets or clears (tracer = nil) the timestamped flag
+// tracer.
+func (f *Flag) SetTimedTracer(tracer TimedTracer) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.tracer = tracer
 	if tracer != nil {
-		tracer.Sample(f.mask, f.value)
+		tracer.TimedSample(time.Now(), f, f.mask, f.value)
 	}
 }
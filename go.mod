@@ -1,5 +1,5 @@
 module zappem.net/pub/io/gpio
 
-go 1.16
+go 1.18
 
 require zappem.net/pub/io/iotracer v0.7.1
@@ -377,9 +377,11 @@ type Bank struct {
 	label string
 	// lines holds the number of GPIO lines.
 	lines int
+	// seq orders this bank relative to others in a transaction.
+	seq uint64
 
-	// tracer, if non-nul, is used to store data traces.
-	tracer Tracer
+	// tracer, if non-nil, is used to store data traces.
+	tracer TimedTracer
 
 	// mu protects all subsequent fields.
 	mu sync.Mutex
@@ -388,6 +390,20 @@ type Bank struct {
 	// bank. It is used by (*Bank).Label().
 	alias string
 
+	// lineAliases holds per-line friendly names, and kernelNames
+	// caches the kernel names of lines. These are used by
+	// (*Bank).LineLabel().
+	lineAliases map[int]string
+	kernelNames map[int]string
+
+	// lineFlags holds the per-line flags set by Configure().
+	lineFlags map[int]LineFlag
+
+	// edges holds the channels of watched input lines, and
+	// edgeReader indicates a goroutine is reading their events.
+	edges      map[int]chan Edge
+	edgeReader bool
+
 	// outs and outsMask capture the most recently written values
 	// of all outputs. The package updates outsWhen when any value
 	// changes. If outsMask is non-zero outsF holds an open file
@@ -399,6 +415,11 @@ type Bank struct {
 	outsF          *os.File
 	setCh          chan bool
 
+	// sentOuts and sentMask hold the output values, and the mask
+	// of traced lines, last successfully written to outsF. Only
+	// writes that change them are stamped and traced.
+	sentOuts, sentMask uint64
+
 	// ins and insMask capture the most recently read value of all
 	// inputs since time, insWhen. If insMask is non-zero insF
 	// holds an open file for obtaining a more recent input
@@ -475,7 +496,7 @@ func (b *Bank) refreshInputLocked() {
 	b.ins = val
 	b.insWhen = when
 	if m := b.insMask | b.outsMask; m != 0 && b.tracer != nil {
-		b.tracer.Sample(m, b.ins|b.outs)
+		b.tracer.TimedSample(when, b, m, b.ins|b.outs)
 	}
 }
 
@@ -527,8 +548,19 @@ func OpenBank(ctx context.Context, path string, poll time.Duration) (*Bank, erro
 	return b, nil
 }
 
-// Close closes the GPIO bank.
+// Close closes the GPIO bank. If the bank tracer is a Flusher, it is
+// flushed.
 func (b *Bank) Close() error {
+	// The tracer is flushed without holding the lock, since the
+	// target of a Dispatcher may call back into the bank while
+	// the queued samples are delivered.
+	b.mu.Lock()
+	tracer := b.tracer
+	b.mu.Unlock()
+	if f, ok := tracer.(Flusher); ok {
+		f.Flush()
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	if b.outsF != nil {
@@ -586,6 +618,89 @@ func (b *Bank) SetAlias(name string) {
 		b.mu.Lock()
 		defer b.mu.Unlock()
 		b.alias = name
+		b.labelAllLocked()
+	}
+}
+
+// SetLineAlias gives a single GPIO line an alias (used by
+// LineLabel()). An empty name removes the alias.
+func (b *Bank) SetLineAlias(g int, name string) error {
+	if err := b.valid(g); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if name == "" {
+		delete(b.lineAliases, g)
+	} else {
+		if b.lineAliases == nil {
+			b.lineAliases = make(map[int]string)
+		}
+		b.lineAliases[g] = name
+	}
+	if (b.insMask|b.outsMask)&(uint64(1)<<g) != 0 {
+		b.labelLocked(g)
+	}
+	return nil
+}
+
+// lineLabelLocked is called with the bank locked and returns the
+// label of line g.
+func (b *Bank) lineLabelLocked(g int) string {
+	if name := b.lineAliases[g]; name != "" {
+		return name
+	}
+	name, ok := b.kernelNames[g]
+	if !ok && b.f != nil {
+		if li, err := b.LineInfo(g); err == nil {
+			name = li.Label()
+			if b.kernelNames == nil {
+				b.kernelNames = make(map[int]string)
+			}
+			b.kernelNames[g] = name
+		}
+	}
+	if name != "" {
+		return name
+	}
+	if b.alias != "" {
+		return fmt.Sprintf("%s_%d", b.alias, g)
+	}
+	return fmt.Sprintf("%s_%d", b.name, g)
+}
+
+// LineLabel returns the label that the bank provides to tracers for
+// line g. In order of preference, this is the alias set with
+// SetLineAlias(), the kernel name of the line, or a name derived from
+// the bank alias or kernel name.
+func (b *Bank) LineLabel(g int) string {
+	if err := b.valid(g); err != nil {
+		return ""
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lineLabelLocked(g)
+}
+
+// labelLocked is called with the bank locked and provides the label
+// of line g to the tracer, if it accepts labels.
+func (b *Bank) labelLocked(g int) {
+	switch t := b.tracer.(type) {
+	case SourceLabeler:
+		t.LabelLine(b, g, b.lineLabelLocked(g))
+	case Labeler:
+		t.Label(g, b.lineLabelLocked(g))
+	}
+}
+
+// labelAllLocked is called with the bank locked and provides the
+// labels of all enabled lines to the tracer.
+func (b *Bank) labelAllLocked() {
+	if b.tracer == nil {
+		return
+	}
+	for _, g := range unpackMask(b.insMask | b.outsMask) {
+		b.labelLocked(int(g))
 	}
 }
 
@@ -640,8 +755,16 @@ func unpackMask(mask uint64) []uint32 {
 	return up
 }
 
+// lineConfigFlags are the flags that can be set per line with
+// Configure(), and driveFlags the subset that only apply to outputs.
+const (
+	lineConfigFlags = LineFlagActiveLow | driveFlags | LineFlagBiasPullUp | LineFlagBiasPullDown | LineFlagBiasDisabled
+	driveFlags      = LineFlagOpenDrain | LineFlagOpenSource
+)
+
 // configGPIOs enables GPIOs for output and input purposes. It returns
-// an access file descriptor for the specific GPIOs.
+// an access file descriptor for the specific GPIOs. Lines with flags
+// set by Configure() are requested with those flags too.
 func (b *Bank) configGPIOs(flags LineFlag, mask uint64) (int, error) {
 	up := unpackMask(mask)
 	n := uint32(len(up))
@@ -651,6 +774,35 @@ func (b *Bank) configGPIOs(flags LineFlag, mask uint64) (int, error) {
 		},
 		NumLines: n,
 	}
+	attrs := make(map[LineFlag]uint64)
+	var order []LineFlag
+	for j, g := range up {
+		extra := b.lineFlags[int(g)]
+		if flags&LineFlagOutput == 0 {
+			extra &^= driveFlags
+			if _, ok := b.edges[int(g)]; ok {
+				extra |= edgeFlags
+			}
+		}
+		if extra == 0 {
+			continue
+		}
+		if _, ok := attrs[extra]; !ok {
+			order = append(order, extra)
+		}
+		attrs[extra] |= uint64(1) << j
+	}
+	if len(order) > lineNumAttrMax {
+		return -1, fmt.Errorf("too many distinct line configurations (%d)", len(order))
+	}
+	for i, extra := range order {
+		a := &lr.Config.Attrs[i]
+		a.Mask = attrs[extra]
+		if err := a.Attr.SetFlags(flags | extra); err != nil {
+			return -1, err
+		}
+	}
+	lr.Config.NumAttrs = uint32(len(order))
 	copy(lr.Consumer[:5], []byte("ioctl"))
 	copy(lr.Offsets[:n], up[:])
 	buf := new(bytes.Buffer)
@@ -692,10 +844,22 @@ func (b *Bank) setOutsLocked() error {
 	if err := binary.Write(buf, localEndianness, bits); err != nil {
 		return err
 	}
-	if m := b.insMask | b.outsMask; b.tracer != nil {
-		b.tracer.Sample(m, b.ins|b.outs)
+	if err := ioctl(b.outsF, cmdLineSetValues, buf.Bytes()); err != nil {
+		return err
+	}
+	m, outs := b.insMask|b.outsMask, b.outs&b.outsMask
+	if outs == b.sentOuts && m == b.sentMask {
+		return nil
+	}
+	now := time.Now()
+	if outs != b.sentOuts {
+		b.outsWhen = now
+	}
+	b.sentOuts, b.sentMask = outs, m
+	if b.tracer != nil {
+		b.tracer.TimedSample(now, b, m, b.ins|b.outs)
 	}
-	return ioctl(b.outsF, cmdLineSetValues, buf.Bytes())
+	return nil
 }
 
 // enableRWLocked is called with the bank locked, closes the existing
@@ -721,6 +885,9 @@ func (b *Bank) enableRWLocked() error {
 		if err != nil {
 			return fmt.Errorf("failed to enable %b for input: %v", b.insMask, err)
 		}
+		// Non-blocking reads allow a watched line event reader
+		// to be interrupted by closing the file.
+		syscall.SetNonblock(f, true)
 		b.insF = os.NewFile(uintptr(f), "ins")
 	}
 	b.pollMask = (1 << bits.OnesCount64(b.insMask)) - 1
@@ -744,6 +911,7 @@ func (b *Bank) Enable(g int, on bool) error {
 	}
 
 	b.insMask |= bit
+	b.labelLocked(g)
 	return b.enableRWLocked()
 }
 
@@ -771,8 +939,59 @@ func (b *Bank) Output(g int, output bool) error {
 	return b.enableRWLocked()
 }
 
+// Configure sets flags for line g, in addition to those that set its
+// direction. The flags are a combination of LineFlagActiveLow,
+// LineFlagOpenDrain, LineFlagOpenSource and the LineFlagBias* flags.
+// The drive flags (open-drain and open-source) only take effect while
+// the line is an output. If the line is enabled, it is reconfigured
+// immediately.
+func (b *Bank) Configure(g int, flags LineFlag) error {
+	if err := b.valid(g); err != nil {
+		return err
+	}
+	if flags&^lineConfigFlags != 0 {
+		return fmt.Errorf("unsupported line flags: %v", flags&^lineConfigFlags)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lineFlags == nil {
+		b.lineFlags = make(map[int]LineFlag)
+	}
+	if b.lineFlags[g] == flags {
+		return nil
+	}
+	b.lineFlags[g] = flags
+	if (b.insMask|b.outsMask)&(uint64(1)<<g) == 0 {
+		return nil
+	}
+	return b.enableRWLocked()
+}
+
+// readOutputLocked reads the actual level of output line g. This can
+// differ from the driven value for open-drain and open-source lines.
+func (b *Bank) readOutputLocked(g int) (bool, error) {
+	bit := uint64(1) << g
+	if b.outsF == nil {
+		return b.outs&bit != 0, nil
+	}
+	ans := LineValues{
+		Mask: uint64(1) << bits.OnesCount64(b.outsMask&(bit-1)),
+	}
+	buf := new(bytes.Buffer)
+	binary.Write(buf, localEndianness, ans)
+	if err := ioctl(b.outsF, cmdLineGetValues, buf.Bytes()); err != nil {
+		return false, err
+	}
+	if err := binary.Read(bytes.NewReader(buf.Bytes()), localEndianness, &ans); err != nil {
+		return false, err
+	}
+	return ans.Bits&ans.Mask != 0, nil
+}
+
 // Get reads the current (cached) GPIO value for outputs and performs
-// a GPIO read for inputs.
+// a GPIO read for inputs. For open-drain and open-source outputs,
+// the actual line level is read, since another device may be
+// driving the line.
 func (b *Bank) Get(g int) (bool, error) {
 	if err := b.valid(g); err != nil {
 		return false, err
@@ -785,6 +1004,9 @@ func (b *Bank) Get(g int) (bool, error) {
 		return false, fmt.Errorf("%d is not enabled in %q bank", g, b.name)
 	}
 	if bit&b.outsMask != 0 {
+		if b.lineFlags[g]&driveFlags != 0 {
+			return b.readOutputLocked(g)
+		}
 		return bit&b.outs != 0, nil
 	}
 	b.refreshInputLocked()
@@ -860,12 +1082,32 @@ func (b *Bank) Set(g int, on bool) error {
 	return err
 }
 
+// Annotate records text in the timeline of the bank's trace, if its
+// tracer is an Annotator.
+func (b *Bank) Annotate(text string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if a, ok := b.tracer.(Annotator); ok {
+		a.Annotate(time.Now(), b, text)
+	}
+}
+
 // SetTracer begins tracing IO with the supplied tracer.
 func (b *Bank) SetTracer(tracer Tracer) {
+	b.SetTimedTracer(Timed(tracer))
+}
+
+// SetTimedTracer begins tracing IO with the supplied timestamped
+// tracer. Input samples are stamped with the time they were read and
+// output samples with the time they were written. If the tracer is a
+// SourceLabeler or Labeler, it is given the LineLabel() of each line
+// as it is enabled.
+func (b *Bank) SetTimedTracer(tracer TimedTracer) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.tracer = tracer
+	b.labelAllLocked()
 	if m := b.insMask | b.outsMask; m != 0 && tracer != nil {
-		tracer.Sample(m, b.ins|b.outs)
+		tracer.TimedSample(time.Now(), b, m, b.ins|b.outs)
 	}
 }
@@ -1,6 +1,9 @@
 package gpio
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func TestFlag(t *testing.T) {
 	var f *Flag
@@ -26,6 +29,44 @@ func TestFlag(t *testing.T) {
 	}
 }
 
+func TestFlagWatch(t *testing.T) {
+	f := NewFlag()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := f.Watch(ctx, 3)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if _, err := f.Watch(ctx, 3); err == nil {
+		t.Error("second Watch of flag[3] succeeded")
+	}
+	for _, on := range []bool{true, true, false} {
+		f.Set(3, on)
+	}
+	f.Set(4, true)
+	// Transactions, as used by a Player, also deliver edges.
+	a, b := FlagLine(f, 3), FlagLine(f, 5)
+	txn, err := Hold(a, b)
+	if err != nil {
+		t.Fatalf("Hold failed: %v", err)
+	}
+	txn.Set(a, true)
+	txn.Set(b, true)
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	cancel()
+	var got []bool
+	for e := range ch {
+		if e.Index != 3 || e.When.IsZero() {
+			t.Errorf("bad edge: %+v", e)
+		}
+		got = append(got, e.On)
+	}
+	if len(got) != 3 || !got[0] || got[1] || !got[2] {
+		t.Errorf("got edges %v, want [true false true]", got)
+	}
+}
+
 func TestVector(t *testing.T) {
 	var v *Vector
 	if err := v.valid(3); err == nil {
@@ -48,3 +89,60 @@ func TestVector(t *testing.T) {
 		t.Errorf("bad label: got=%q want=\"<R[2]>\"", got)
 	}
 }
+
+// setAll is a generic function that sets indices of any IO array.
+func setAll[T Value](x IO[T], value T, indices ...int) error {
+	for _, i := range indices {
+		if err := x.Set(i, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestIO(t *testing.T) {
+	f := NewFlag()
+	if err := setAll[bool](f, true, 3, 4); err != nil {
+		t.Fatalf("failed to set flags: %v", err)
+	}
+	if on, _ := f.Get(4); !on {
+		t.Errorf("flag[4] not set")
+	}
+	v := NewVector(2)
+	if err := setAll[int64](v, 9, 0, 1); err != nil {
+		t.Fatalf("failed to set vector: %v", err)
+	}
+	if err := setAll[int64](v, 9, 2); err == nil {
+		t.Errorf("setting vec[2] of 2 should fail")
+	}
+}
+
+// labelRecorder records the labels it is given.
+type labelRecorder struct {
+	timedRecorder
+	labels map[int]string
+}
+
+func (r *labelRecorder) LabelLine(src Named, index int, label string) error {
+	r.labels[index] = label
+	return nil
+}
+
+func TestLineLabel(t *testing.T) {
+	b := &Bank{name: "chip", lines: 8, insMask: 0x6}
+	if got := b.LineLabel(1); got != "chip_1" {
+		t.Errorf("line label got=%q want=\"chip_1\"", got)
+	}
+	r := &labelRecorder{labels: make(map[int]string)}
+	b.SetTimedTracer(r)
+	b.SetAlias("B")
+	if err := b.SetLineAlias(2, "ready"); err != nil {
+		t.Fatalf("failed to set line alias: %v", err)
+	}
+	if err := b.SetLineAlias(9, "bad"); err == nil {
+		t.Error("line alias for invalid line accepted")
+	}
+	if r.labels[1] != "B_1" || r.labels[2] != "ready" || len(r.labels) != 2 {
+		t.Errorf("bad tracer labels: %v", r.labels)
+	}
+}
@@ -0,0 +1,385 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// These are the causes of a failed I2C transfer, reported within an
+// *I2CError.
+var (
+	ErrNACK        = errors.New("no acknowledgement")
+	ErrArbitration = errors.New("arbitration lost")
+	ErrStretch     = errors.New("clock stretched too long")
+	ErrBusStuck    = errors.New("bus stuck low")
+)
+
+// I2CError reports a failed I2C transfer. Use errors.Is() to check
+// for one of the causes, such as ErrNACK.
+type I2CError struct {
+	// Addr is the address of the transfer, including I2CTenBit
+	// for a 10-bit address.
+	Addr uint16
+
+	// Byte is the index of the data byte that failed, or -1 if
+	// the addressing failed.
+	Byte int
+
+	Err error
+}
+
+// Error describes the failure.
+func (e *I2CError) Error() string {
+	if e.Byte < 0 {
+		return fmt.Sprintf("I2C address %s: %v", i2cAddr(e.Addr), e.Err)
+	}
+	return fmt.Sprintf("I2C address %s byte %d: %v", i2cAddr(e.Addr), e.Byte, e.Err)
+}
+
+// Unwrap returns the cause of the failure.
+func (e *I2CError) Unwrap() error {
+	return e.Err
+}
+
+// I2CTenBit marks an I2C address as a 10-bit address.
+const I2CTenBit uint16 = 1 << 15
+
+// i2cAddr formats an address.
+func i2cAddr(addr uint16) string {
+	if addr&I2CTenBit != 0 {
+		return fmt.Sprintf("0x%03x(10-bit)", addr&^I2CTenBit)
+	}
+	return fmt.Sprintf("0x%02x", addr)
+}
+
+// I2C is a bit-banged I2C master. Its scl and sda lines must be open
+// drain, with pull-ups, so that slaves can pull them low: for a Bank,
+// configure them with LineFlagOpenDrain|LineFlagBiasPullUp and enable
+// them as outputs. Setting such a line releases it and clearing it
+// pulls it low, while reading it returns the actual level.
+type I2C struct {
+	io       IO[bool]
+	scl, sda int
+	half     time.Duration
+
+	// mu serializes transfers and protects the subsequent fields.
+	mu sync.Mutex
+
+	// started indicates a start condition has been sent without a
+	// subsequent stop.
+	started bool
+
+	// stretch bounds how long a slave may hold scl low.
+	stretch time.Duration
+}
+
+// NewI2C returns an I2C master using the open-drain lines scl and sda
+// of io, clocked at up to hz, or as fast as possible if hz is zero.
+// Both lines are released.
+func NewI2C(io IO[bool], scl, sda int, hz int) (*I2C, error) {
+	c := &I2C{
+		io:      io,
+		scl:     scl,
+		sda:     sda,
+		stretch: 25 * time.Millisecond,
+	}
+	if hz > 0 {
+		c.half = time.Second / time.Duration(2*hz)
+	}
+	if err := io.Set(sda, true); err != nil {
+		return nil, err
+	}
+	if err := io.Set(scl, true); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetStretchLimit sets how long a slave may stretch the clock, by
+// holding scl low, before a transfer fails with ErrStretch. The
+// default is 25ms.
+func (c *I2C) SetStretchLimit(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stretch = d
+}
+
+// sclHigh releases scl and waits for it to rise, allowing for a slave
+// stretching the clock.
+func (c *I2C) sclHigh(p *pacer) error {
+	if err := c.io.Set(c.scl, true); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(c.stretch)
+	for stretched := false; ; stretched = true {
+		on, err := c.io.Get(c.scl)
+		if err != nil {
+			return err
+		}
+		if on {
+			if stretched {
+				p.start()
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrStretch
+		}
+		runtime.Gosched()
+	}
+}
+
+// writeBit clocks out a single bit. A released (1) bit that reads
+// back as 0 indicates another master has won arbitration.
+func (c *I2C) writeBit(p *pacer, on bool) error {
+	if err := c.io.Set(c.sda, on); err != nil {
+		return err
+	}
+	p.wait(c.half)
+	if err := c.sclHigh(p); err != nil {
+		return err
+	}
+	if on {
+		if got, err := c.io.Get(c.sda); err != nil {
+			return err
+		} else if !got {
+			return ErrArbitration
+		}
+	}
+	p.wait(c.half)
+	return c.io.Set(c.scl, false)
+}
+
+// readBit clocks in a single bit.
+func (c *I2C) readBit(p *pacer) (bool, error) {
+	if err := c.io.Set(c.sda, true); err != nil {
+		return false, err
+	}
+	p.wait(c.half)
+	if err := c.sclHigh(p); err != nil {
+		return false, err
+	}
+	on, err := c.io.Get(c.sda)
+	if err != nil {
+		return false, err
+	}
+	p.wait(c.half)
+	return on, c.io.Set(c.scl, false)
+}
+
+// start sends a start, or repeated start, condition.
+func (c *I2C) start(p *pacer) error {
+	if c.started {
+		if err := c.io.Set(c.sda, true); err != nil {
+			return err
+		}
+		p.wait(c.half)
+		if err := c.sclHigh(p); err != nil {
+			return err
+		}
+		p.wait(c.half)
+	}
+	if on, err := c.io.Get(c.sda); err != nil {
+		return err
+	} else if !on {
+		return ErrArbitration
+	}
+	if err := c.io.Set(c.sda, false); err != nil {
+		return err
+	}
+	c.started = true
+	p.wait(c.half)
+	if err := c.io.Set(c.scl, false); err != nil {
+		return err
+	}
+	p.wait(c.half)
+	return nil
+}
+
+// stop sends a stop condition.
+func (c *I2C) stop(p *pacer) error {
+	c.started = false
+	if err := c.io.Set(c.sda, false); err != nil {
+		return err
+	}
+	p.wait(c.half)
+	if err := c.sclHigh(p); err != nil {
+		return err
+	}
+	p.wait(c.half)
+	if err := c.io.Set(c.sda, true); err != nil {
+		return err
+	}
+	p.wait(c.half)
+	if on, err := c.io.Get(c.sda); err != nil {
+		return err
+	} else if !on {
+		return ErrArbitration
+	}
+	return nil
+}
+
+// writeByte clocks out a byte, MSB first, and returns whether it was
+// acknowledged.
+func (c *I2C) writeByte(p *pacer, b byte) (bool, error) {
+	for i := 7; i >= 0; i-- {
+		if err := c.writeBit(p, b>>i&1 != 0); err != nil {
+			return false, err
+		}
+	}
+	nack, err := c.readBit(p)
+	return !nack, err
+}
+
+// readByte clocks in a byte, MSB first, and acknowledges it if ack.
+func (c *I2C) readByte(p *pacer, ack bool) (byte, error) {
+	var b byte
+	for i := 0; i < 8; i++ {
+		on, err := c.readBit(p)
+		if err != nil {
+			return 0, err
+		}
+		b <<= 1
+		if on {
+			b |= 1
+		}
+	}
+	return b, c.writeBit(p, !ack)
+}
+
+// address sends the address bytes of a transfer.
+func (c *I2C) address(p *pacer, addr uint16, read bool) error {
+	var rw byte
+	if read {
+		rw = 1
+	}
+	bs := []byte{byte(addr<<1) | rw}
+	if addr&I2CTenBit != 0 {
+		bs = []byte{0xf0 | byte(addr>>7)&6 | rw}
+		if !read {
+			bs = append(bs, byte(addr))
+		}
+	}
+	if err := c.start(p); err != nil {
+		return err
+	}
+	for _, b := range bs {
+		if ack, err := c.writeByte(p, b); err != nil {
+			return err
+		} else if !ack {
+			return ErrNACK
+		}
+	}
+	return nil
+}
+
+// Tx performs an I2C transfer with the slave at addr. If w is not
+// empty, it is written to the slave, and if r is not empty, it is
+// then filled with bytes read from the slave following a repeated
+// start. A 10-bit address, marked with I2CTenBit, is always sent in
+// write mode first. Failures are reported as an *I2CError. A bus stop
+// condition is sent at the end of the transfer, unless arbitration
+// was lost.
+func (c *I2C) Tx(addr uint16, w, r []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var p pacer
+	p.start()
+	err := c.tx(&p, addr, w, r)
+	if err != nil && errors.Is(err, ErrArbitration) {
+		c.started = false
+		return err
+	}
+	if e := c.stop(&p); err == nil && e != nil {
+		err = &I2CError{Addr: addr, Byte: -1, Err: e}
+	}
+	return err
+}
+
+// tx performs the transfer of Tx without the final stop.
+func (c *I2C) tx(p *pacer, addr uint16, w, r []byte) error {
+	tenBit := addr&I2CTenBit != 0
+	if len(w) != 0 || len(r) == 0 || tenBit {
+		if err := c.address(p, addr, false); err != nil {
+			return &I2CError{Addr: addr, Byte: -1, Err: err}
+		}
+		for i, b := range w {
+			if ack, err := c.writeByte(p, b); err != nil {
+				return &I2CError{Addr: addr, Byte: i, Err: err}
+			} else if !ack {
+				return &I2CError{Addr: addr, Byte: i, Err: ErrNACK}
+			}
+		}
+	}
+	if len(r) == 0 {
+		return nil
+	}
+	if err := c.address(p, addr, true); err != nil {
+		return &I2CError{Addr: addr, Byte: -1, Err: err}
+	}
+	for i := range r {
+		b, err := c.readByte(p, i+1 < len(r))
+		if err != nil {
+			return &I2CError{Addr: addr, Byte: i, Err: err}
+		}
+		r[i] = b
+	}
+	return nil
+}
+
+// Scan probes each of the non-reserved 7-bit addresses, 0x08 to
+// 0x77, and returns those that acknowledge.
+func (c *I2C) Scan() ([]uint16, error) {
+	var found []uint16
+	for addr := uint16(0x08); addr < 0x78; addr++ {
+		err := c.Tx(addr, nil, nil)
+		if err == nil {
+			found = append(found, addr)
+		} else if !errors.Is(err, ErrNACK) {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+// Recover frees a bus held low by a slave that was interrupted mid
+// transfer. It clocks scl up to nine times until the slave releases
+// sda, and then sends a stop condition.
+func (c *I2C) Recover() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var p pacer
+	p.start()
+	if err := c.io.Set(c.sda, true); err != nil {
+		return err
+	}
+	for i := 0; i < 9; i++ {
+		if on, err := c.io.Get(c.sda); err != nil {
+			return err
+		} else if on {
+			break
+		}
+		if err := c.io.Set(c.scl, false); err != nil {
+			return err
+		}
+		p.wait(c.half)
+		if err := c.sclHigh(&p); err != nil {
+			return err
+		}
+		p.wait(c.half)
+	}
+	if on, err := c.io.Get(c.sda); err != nil {
+		return err
+	} else if !on {
+		return ErrBusStuck
+	}
+	// The stop needs scl low while sda is pulled low.
+	if err := c.io.Set(c.scl, false); err != nil {
+		return err
+	}
+	p.wait(c.half)
+	return c.stop(&p)
+}
@@ -0,0 +1,318 @@
+package gpio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// These are the states of a simulated I2C slave.
+const (
+	simIdle = iota
+	simAddress
+	simTenLow
+	simWrite
+	simAck
+	simSend
+)
+
+// i2cSim simulates an I2C bus, with pull-ups, and the memory devices
+// attached to it. It implements IO[bool] with line 0 as scl and line 1
+// as sda, where the master releases a line by setting it.
+type i2cSim struct {
+	mscl, msda bool
+	scl, sda   bool
+
+	// sdaLow indicates a device is pulling sda low.
+	sdaLow bool
+
+	// stretch is the number of reads for which scl remains low
+	// after the master releases it, and stretchEach the value it
+	// is reset to on each release.
+	stretch, stretchEach int
+
+	// stuck is the number of clock pulses for which sda is held low
+	// by an interrupted device.
+	stuck int
+
+	// jam simulates another master pulling sda low during an
+	// address.
+	jam bool
+
+	mem    map[uint16][]byte
+	state  int
+	next   int
+	n      int
+	b      byte
+	read   bool
+	first  bool
+	addr   uint16
+	tenHi  byte
+	tenSet bool
+	ptr    int
+}
+
+func newI2CSim() *i2cSim {
+	return &i2cSim{
+		mscl: true,
+		msda: true,
+		scl:  true,
+		sda:  true,
+		mem: map[uint16][]byte{
+			0x50:              make([]byte, 16),
+			0x2a5 | I2CTenBit: make([]byte, 16),
+		},
+	}
+}
+
+func (s *i2cSim) Lines() int             { return 2 }
+func (s *i2cSim) Label(index int) string { return fmt.Sprint("i2c", index) }
+func (s *i2cSim) SetAlias(name string)   {}
+func (s *i2cSim) SetHold(index int) (chan<- bool, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *i2cSim) Get(index int) (bool, error) {
+	if index == 0 {
+		if s.mscl && s.stretch > 0 {
+			s.stretch--
+			return false, nil
+		}
+		return s.mscl, nil
+	}
+	return s.sda, nil
+}
+
+func (s *i2cSim) Set(index int, on bool) error {
+	if index == 0 {
+		if on && !s.mscl {
+			s.stretch = s.stretchEach
+		}
+		s.mscl = on
+	} else {
+		s.msda = on
+	}
+	s.update()
+	return nil
+}
+
+// level computes the wired-AND level of sda.
+func (s *i2cSim) level() bool {
+	return s.msda && !s.sdaLow && !(s.jam && s.state == simAddress)
+}
+
+// update reacts to the bus levels set by the master.
+func (s *i2cSim) update() {
+	scl, sda := s.mscl, s.level()
+	switch {
+	case scl && s.scl && sda != s.sda:
+		if sda {
+			s.state, s.tenSet = simIdle, false
+			s.sdaLow = s.stuck > 0
+		} else {
+			s.state, s.n, s.b = simAddress, 0, 0
+		}
+	case scl && !s.scl:
+		s.rise(sda)
+	case !scl && s.scl:
+		s.fall()
+	}
+	s.scl, s.sda = scl, s.level()
+}
+
+// rise samples sda on the rising edge of scl.
+func (s *i2cSim) rise(sda bool) {
+	switch s.state {
+	case simAddress, simTenLow, simWrite:
+		s.b <<= 1
+		if sda {
+			s.b |= 1
+		}
+		s.n++
+	case simSend:
+		if s.n == 8 && sda {
+			// The master did not acknowledge.
+			s.state = simIdle
+		}
+	}
+}
+
+// fall advances the state on the falling edge of scl.
+func (s *i2cSim) fall() {
+	if s.stuck > 0 {
+		if s.stuck--; s.stuck == 0 {
+			s.sdaLow = false
+		}
+		return
+	}
+	switch s.state {
+	case simAddress, simTenLow, simWrite:
+		if s.n == 8 {
+			s.byte()
+		}
+	case simAck:
+		s.sdaLow = false
+		s.state, s.n, s.b = s.next, 0, 0
+		if s.state == simSend {
+			s.load()
+		}
+	case simSend:
+		if s.n++; s.n < 8 {
+			s.sdaLow = s.b>>(7-s.n)&1 == 0
+		} else if s.n == 8 {
+			s.sdaLow = false
+		} else {
+			s.n = 0
+			s.load()
+		}
+	}
+}
+
+// load starts to send the next memory byte.
+func (s *i2cSim) load() {
+	m := s.mem[s.addr]
+	s.b = m[s.ptr%len(m)]
+	s.ptr++
+	s.sdaLow = s.b&0x80 == 0
+}
+
+// byte handles a received byte, acknowledging it if appropriate.
+func (s *i2cSim) byte() {
+	ack := false
+	switch s.state {
+	case simAddress:
+		s.read = s.b&1 != 0
+		s.next = simWrite
+		if s.read {
+			s.next = simSend
+		}
+		if s.b>>3 == 0x1e {
+			hi := s.b >> 1 & 3
+			if !s.read {
+				s.tenHi = hi
+				s.next = simTenLow
+				for addr := range s.mem {
+					ack = ack || (addr&I2CTenBit != 0 && byte(addr>>8)&3 == hi)
+				}
+			} else {
+				ack = s.tenSet && s.tenHi == hi
+			}
+		} else {
+			s.addr = uint16(s.b >> 1)
+			_, ack = s.mem[s.addr]
+		}
+		s.first = true
+	case simTenLow:
+		s.addr = I2CTenBit | uint16(s.tenHi)<<8 | uint16(s.b)
+		_, ack = s.mem[s.addr]
+		s.tenSet = ack
+		s.next = simWrite
+	case simWrite:
+		if s.first {
+			s.ptr = int(s.b)
+			s.first = false
+		} else {
+			m := s.mem[s.addr]
+			m[s.ptr%len(m)] = s.b
+			s.ptr++
+		}
+		ack = true
+	}
+	if ack {
+		s.sdaLow = true
+		s.state = simAck
+	} else {
+		s.state = simIdle
+	}
+}
+
+func TestI2C(t *testing.T) {
+	bus := newI2CSim()
+	c, err := NewI2C(bus, 0, 1, 0)
+	if err != nil {
+		t.Fatalf("NewI2C failed: %v", err)
+	}
+	for _, addr := range []uint16{0x50, 0x2a5 | I2CTenBit} {
+		if err := c.Tx(addr, []byte{2, 0xde, 0xad, 0xbe, 0xef}, nil); err != nil {
+			t.Fatalf("write to %s failed: %v", i2cAddr(addr), err)
+		}
+		got := make([]byte, 3)
+		if err := c.Tx(addr, []byte{3}, got); err != nil {
+			t.Fatalf("read from %s failed: %v", i2cAddr(addr), err)
+		}
+		if want := []byte{0xad, 0xbe, 0xef}; !bytes.Equal(got, want) {
+			t.Errorf("read from %s got %x, want %x", i2cAddr(addr), got, want)
+		}
+	}
+	if got := bus.mem[0x50][2]; got != 0xde {
+		t.Errorf("memory of 0x50 holds %x, want de", got)
+	}
+
+	// A read without a write continues from the current pointer.
+	got := make([]byte, 1)
+	if err := c.Tx(0x50, nil, got); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if got[0] != 0x00 {
+		t.Errorf("read got %x, want 00", got[0])
+	}
+
+	found, err := c.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if fmt.Sprint(found) != "[80]" {
+		t.Errorf("Scan found %v, want [80]", found)
+	}
+
+	err = c.Tx(0x51, []byte{0}, nil)
+	var e *I2CError
+	if !errors.As(err, &e) || !errors.Is(err, ErrNACK) || e.Byte != -1 {
+		t.Errorf("Tx to missing device returned %v", err)
+	}
+	if !bus.scl || !bus.sda {
+		t.Errorf("bus not released after NACK: scl=%v sda=%v", bus.scl, bus.sda)
+	}
+
+	bus.stretchEach = 5
+	if err := c.Tx(0x50, []byte{2}, got); err != nil {
+		t.Errorf("stretched read failed: %v", err)
+	} else if got[0] != 0xde {
+		t.Errorf("stretched read got %x, want de", got[0])
+	}
+	bus.stretchEach = 1 << 30
+	c.SetStretchLimit(time.Millisecond)
+	if err := c.Tx(0x50, []byte{2}, nil); !errors.Is(err, ErrStretch) {
+		t.Errorf("overstretched write returned %v", err)
+	}
+	bus.stretchEach, bus.stretch = 0, 0
+	if err := c.Recover(); err != nil {
+		t.Errorf("Recover after stretch failed: %v", err)
+	}
+
+	bus.jam = true
+	if err := c.Tx(0x50, []byte{2}, nil); !errors.Is(err, ErrArbitration) {
+		t.Errorf("jammed write returned %v", err)
+	}
+	bus.jam = false
+	c.Recover()
+
+	bus.stuck, bus.sdaLow = 3, true
+	bus.update()
+	if err := c.Tx(0x50, nil, got); !errors.Is(err, ErrArbitration) {
+		t.Errorf("read on a stuck bus returned %v", err)
+	}
+	if err := c.Recover(); err != nil {
+		t.Errorf("Recover failed: %v", err)
+	}
+	if err := c.Tx(0x50, []byte{2}, got); err != nil || got[0] != 0xde {
+		t.Errorf("read after recovery got %x, %v", got[0], err)
+	}
+	bus.stuck, bus.sdaLow = 20, true
+	bus.update()
+	if err := c.Recover(); !errors.Is(err, ErrBusStuck) {
+		t.Errorf("Recover of a stuck bus returned %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package gpio
+
+// Named is the part of the API common to all of the Bank, Flag and
+// Vector types that is concerned with identifying their lines.
+type Named interface {
+	// Lines returns the number of indexed values.
+	Lines() int
+	// Label returns a string name for the indexed value.
+	Label(index int) string
+	// SetAlias sets a friendly name for the whole array of values.
+	SetAlias(name string)
+}
+
+// Value holds the types of value accessed via the IO interface.
+type Value interface {
+	bool | int64
+}
+
+// IO is the API common to the Bank, Flag (T=bool) and Vector
+// (T=int64) types. It permits generic code to operate on any of them.
+type IO[T Value] interface {
+	Named
+	// Get returns the current indexed value.
+	Get(index int) (T, error)
+	// Set sets the indexed value atomically.
+	Set(index int, value T) error
+	// SetHold locks the indexed value until the returned channel
+	// is closed. Any value written to the channel is applied.
+	SetHold(index int) (chan<- T, error)
+}
+
+// Compile time confirmation that the IO interface is satisfied.
+var (
+	_ IO[bool]  = (*Bank)(nil)
+	_ IO[bool]  = (*Flag)(nil)
+	_ IO[int64] = (*Vector)(nil)
+)
@@ -0,0 +1,342 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// KeypadConfig holds the settings of a Keypad.
+type KeypadConfig struct {
+	// Keys names the keys, indexed by row and column. Keys it does
+	// not name are named "row,col".
+	Keys [][]string
+
+	// Scan is the interval between scans of the matrix (default
+	// 10ms), and Settle is how long after a row is driven its
+	// columns are read (default 10us).
+	Scan, Settle time.Duration
+
+	// Debounce is how long a key must be seen in a new state for
+	// the change to be accepted (default 20ms). It is rounded up
+	// to a whole number of scans.
+	Debounce time.Duration
+
+	// Diodes indicates each key has a diode in series, so any
+	// combination of keys can be detected. Without diodes, three
+	// keys on the corners of a rectangle make the fourth appear
+	// pressed, so keys involved in such a pattern keep their states
+	// until it is resolved.
+	Diodes bool
+}
+
+// defaults fills in the unspecified values of c.
+func (c KeypadConfig) defaults() KeypadConfig {
+	if c.Scan == 0 {
+		c.Scan = 10 * time.Millisecond
+	}
+	if c.Settle == 0 {
+		c.Settle = 10 * time.Microsecond
+	}
+	if c.Debounce == 0 {
+		c.Debounce = 20 * time.Millisecond
+	}
+	return c
+}
+
+// KeyEvent reports a key being pressed (Down) or released.
+type KeyEvent struct {
+	When     time.Time
+	Row, Col int
+	Key      string
+	Down     bool
+}
+
+// String summarizes the event.
+func (e KeyEvent) String() string {
+	if e.Down {
+		return fmt.Sprintf("key %q down", e.Key)
+	}
+	return fmt.Sprintf("key %q up", e.Key)
+}
+
+// keypadDepth is the number of undelivered events a Keypad holds.
+// Further events are dropped until the receiver catches up.
+const keypadDepth = 64
+
+// Keypad scans a matrix keypad. Each row line is driven low in turn,
+// and the column lines, which are pulled up, read low for the keys of
+// that row that are pressed. When the lines are those of a Bank, the
+// rows are configured as open drain outputs, so pressing several keys
+// of a column cannot short two rows together, and the columns are
+// given pull-ups. The scans, and key events, appear in the bank trace.
+type Keypad struct {
+	io         IO[bool]
+	rows, cols []int
+	cfg        KeypadConfig
+
+	// clock, if non-nil, replaces the real time.
+	clock clock
+
+	// state holds the debounced keys of each row as column bit
+	// masks, and counts the consecutive scans each key has been
+	// seen in the other state. ghosting indicates the last scan was
+	// ambiguous. They are only accessed by the scanning goroutine.
+	state    []uint64
+	counts   [][]int
+	ghosting bool
+
+	events chan KeyEvent
+
+	// mu protects all subsequent fields.
+	mu     sync.Mutex
+	scan   time.Duration
+	ghosts uint64
+	err    error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewKeypad scans the keypad with the row output lines rows and the
+// column input lines cols of io, until ctx is done or Close() is
+// called.
+func NewKeypad(ctx context.Context, io IO[bool], rows, cols []int, cfg KeypadConfig) (*Keypad, error) {
+	k, err := newKeypad(io, rows, cols, cfg)
+	if err != nil {
+		return nil, err
+	}
+	k.start(ctx)
+	return k, nil
+}
+
+// newKeypad prepares a Keypad without starting to scan.
+func newKeypad(io IO[bool], rows, cols []int, cfg KeypadConfig) (*Keypad, error) {
+	cfg = cfg.defaults()
+	if len(rows) == 0 || len(cols) == 0 || len(cols) > 64 {
+		return nil, fmt.Errorf("invalid keypad size %dx%d", len(rows), len(cols))
+	}
+	if cfg.Scan <= 0 || cfg.Settle < 0 || cfg.Debounce < 0 {
+		return nil, fmt.Errorf("invalid keypad timing scan=%v settle=%v debounce=%v", cfg.Scan, cfg.Settle, cfg.Debounce)
+	}
+	if b, ok := io.(*Bank); ok {
+		for _, g := range rows {
+			if err := b.Configure(g, LineFlagOpenDrain); err != nil {
+				return nil, err
+			}
+		}
+		for _, g := range cols {
+			if err := b.Configure(g, LineFlagBiasPullUp); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, g := range rows {
+		if err := io.Set(g, true); err != nil {
+			return nil, err
+		}
+	}
+	k := &Keypad{
+		io:     io,
+		rows:   append([]int(nil), rows...),
+		cols:   append([]int(nil), cols...),
+		cfg:    cfg,
+		state:  make([]uint64, len(rows)),
+		events: make(chan KeyEvent, keypadDepth),
+		scan:   cfg.Scan,
+		done:   make(chan struct{}),
+	}
+	for range rows {
+		k.counts = append(k.counts, make([]int, len(cols)))
+	}
+	return k, nil
+}
+
+// start launches the goroutine that scans the keypad.
+func (k *Keypad) start(ctx context.Context) {
+	ctx, k.cancel = context.WithCancel(ctx)
+	go k.run(ctx)
+}
+
+// Events returns the channel over which key events are delivered. It
+// is closed once the keypad is closed. Events are dropped if the
+// channel is not drained promptly.
+func (k *Keypad) Events() <-chan KeyEvent {
+	return k.events
+}
+
+// SetScan changes the interval between scans of the matrix. The
+// debounce time is unchanged.
+func (k *Keypad) SetScan(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("invalid keypad scan interval %v", d)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.scan = d
+	return nil
+}
+
+// Ghosts returns the number of scans in which an ambiguous pattern of
+// keys was detected. It is always zero for keypads with diodes.
+func (k *Keypad) Ghosts() uint64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.ghosts
+}
+
+// Close stops scanning and returns the first error encountered while
+// scanning.
+func (k *Keypad) Close() error {
+	k.cancel()
+	<-k.done
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.err
+}
+
+// Key returns the name of the key at row and col.
+func (k *Keypad) Key(row, col int) string {
+	if row < len(k.cfg.Keys) && col < len(k.cfg.Keys[row]) && k.cfg.Keys[row][col] != "" {
+		return k.cfg.Keys[row][col]
+	}
+	return fmt.Sprintf("%d,%d", row, col)
+}
+
+// run scans the keypad until ctx is done or scanning fails.
+func (k *Keypad) run(ctx context.Context) {
+	defer close(k.done)
+	defer close(k.events)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-timer.C:
+			if err := k.step(now); err != nil {
+				k.mu.Lock()
+				k.err = err
+				k.mu.Unlock()
+				return
+			}
+		}
+		k.mu.Lock()
+		timer.Reset(k.scan)
+		k.mu.Unlock()
+	}
+}
+
+// read returns the pressed keys of each row as column bit masks.
+func (k *Keypad) read() ([]uint64, error) {
+	raw := make([]uint64, len(k.rows))
+	p := &pacer{clock: k.clock}
+	for r, g := range k.rows {
+		if err := k.io.Set(g, false); err != nil {
+			return nil, err
+		}
+		p.start()
+		p.wait(k.cfg.Settle)
+		for c, col := range k.cols {
+			on, err := k.io.Get(col)
+			if err != nil {
+				k.io.Set(g, true)
+				return nil, err
+			}
+			if !on {
+				raw[r] |= 1 << c
+			}
+		}
+		if err := k.io.Set(g, true); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// ambiguous returns, as column bit masks for each row, the keys that
+// cannot be distinguished in raw because of ghosting. Any two rows
+// with two or more keys in common could include a ghost key.
+func ambiguous(raw []uint64) []uint64 {
+	amb := make([]uint64, len(raw))
+	for i := range raw {
+		for j := i + 1; j < len(raw); j++ {
+			if common := raw[i] & raw[j]; bits.OnesCount64(common) >= 2 {
+				amb[i] |= common
+				amb[j] |= common
+			}
+		}
+	}
+	return amb
+}
+
+// step scans the matrix once, at time now, and delivers the debounced
+// key changes.
+func (k *Keypad) step(now time.Time) error {
+	raw, err := k.read()
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	need := 1
+	if n := int((k.cfg.Debounce + k.scan - 1) / k.scan); n > 1 {
+		need = n
+	}
+	k.mu.Unlock()
+
+	var amb []uint64
+	ghosting := false
+	if !k.cfg.Diodes {
+		amb = ambiguous(raw)
+		for _, m := range amb {
+			ghosting = ghosting || m != 0
+		}
+	}
+	if ghosting {
+		k.mu.Lock()
+		k.ghosts++
+		k.mu.Unlock()
+		if !k.ghosting {
+			k.annotate("keypad ghosting")
+		}
+	}
+	k.ghosting = ghosting
+	for r := range k.rows {
+		for c := range k.cols {
+			bit := uint64(1) << c
+			count := &k.counts[r][c]
+			if (raw[r]^k.state[r])&bit == 0 || (amb != nil && amb[r]&bit != 0) {
+				*count = 0
+				continue
+			}
+			if *count++; *count < need {
+				continue
+			}
+			*count = 0
+			k.state[r] ^= bit
+			e := KeyEvent{
+				When: now,
+				Row:  r,
+				Col:  c,
+				Key:  k.Key(r, c),
+				Down: k.state[r]&bit != 0,
+			}
+			k.annotate(e.String())
+			select {
+			case k.events <- e:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// annotate records text in the trace of the keypad lines, if they
+// support annotations.
+func (k *Keypad) annotate(text string) {
+	if a, ok := k.io.(interface{ Annotate(string) }); ok {
+		a.Annotate(text)
+	}
+}
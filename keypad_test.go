@@ -0,0 +1,159 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// keypadSim simulates a 3x3 keypad matrix, with rows on lines 0-2 and
+// columns on lines 3-5. Without diodes, a pressed key connects its row
+// and column in both directions.
+type keypadSim struct {
+	diodes  bool
+	low     [3]bool
+	pressed [3][3]bool
+}
+
+func (s *keypadSim) Lines() int             { return 6 }
+func (s *keypadSim) Label(index int) string { return fmt.Sprint(index) }
+func (s *keypadSim) SetAlias(name string)   {}
+func (s *keypadSim) SetHold(index int) (chan<- bool, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *keypadSim) Set(index int, on bool) error {
+	if index >= 3 {
+		return errors.New("not an output")
+	}
+	s.low[index] = !on
+	return nil
+}
+
+// Get reads a column, which is low if it is connected to a row driven
+// low.
+func (s *keypadSim) Get(index int) (bool, error) {
+	col := index - 3
+	if s.diodes {
+		for r := range s.low {
+			if s.low[r] && s.pressed[r][col] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	rows, cols := [3]bool{}, [3]bool{}
+	cols[col] = true
+	for changed := true; changed; {
+		changed = false
+		for r := range rows {
+			for c := range cols {
+				if s.pressed[r][c] && rows[r] != cols[c] {
+					rows[r], cols[c], changed = true, true, true
+				}
+			}
+		}
+	}
+	for r := range rows {
+		if rows[r] && s.low[r] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func TestKeypad(t *testing.T) {
+	for _, diodes := range []bool{false, true} {
+		s := &keypadSim{diodes: diodes}
+		k, err := newKeypad(s, []int{0, 1, 2}, []int{3, 4, 5}, KeypadConfig{
+			Keys:     [][]string{{"1", "2", "3"}, {"4", "5", "6"}, {"7", "8"}},
+			Scan:     5 * time.Millisecond,
+			Settle:   time.Microsecond,
+			Debounce: 10 * time.Millisecond,
+			Diodes:   diodes,
+		})
+		if err != nil {
+			t.Fatalf("newKeypad failed: %v", err)
+		}
+		var got []string
+		scan := func(n int) {
+			for i := 0; i < n; i++ {
+				if err := k.step(time.Now()); err != nil {
+					t.Fatalf("scan failed: %v", err)
+				}
+			}
+			for len(k.events) != 0 {
+				got = append(got, (<-k.events).String())
+			}
+		}
+		s.pressed[0][0] = true
+		scan(1)
+		s.pressed[0][0] = false // Bounce.
+		scan(1)
+		s.pressed[0][0] = true
+		scan(2)
+		s.pressed[0][1] = true
+		scan(2)
+		s.pressed[1][0] = true
+		scan(3)
+		s.pressed[0][1] = false
+		scan(2)
+		s.pressed[2][2] = true
+		scan(2)
+		want := []string{`key "1" down`, `key "2" down`}
+		if diodes {
+			want = append(want, `key "4" down`, `key "2" up`)
+		} else {
+			// The ghost of key 5 hides key 4 while key 2 is
+			// held.
+			want = append(want, `key "2" up`, `key "4" down`)
+		}
+		want = append(want, `key "2,2" down`)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("diodes=%v: got %q, want %q", diodes, got, want)
+		}
+		if n := k.Ghosts(); (n != 0) == diodes {
+			t.Errorf("diodes=%v: got %d ghosted scans", diodes, n)
+		}
+		for r, low := range s.low {
+			if low {
+				t.Errorf("diodes=%v: row %d left driven", diodes, r)
+			}
+		}
+	}
+}
+
+func TestKeypadScanning(t *testing.T) {
+	s := &keypadSim{}
+	s.pressed[1][2] = true
+	k, err := NewKeypad(context.Background(), s, []int{0, 1, 2}, []int{3, 4, 5}, KeypadConfig{
+		Scan:     time.Millisecond,
+		Debounce: 2 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewKeypad failed: %v", err)
+	}
+	if err := k.SetScan(0); err == nil {
+		t.Error("zero scan interval accepted")
+	}
+	if err := k.SetScan(2 * time.Millisecond); err != nil {
+		t.Errorf("SetScan failed: %v", err)
+	}
+	select {
+	case e := <-k.Events():
+		if e.Row != 1 || e.Col != 2 || !e.Down || e.Key != "1,2" {
+			t.Errorf("got event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no key event")
+	}
+	if err := k.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, ok := <-k.Events(); ok {
+		t.Error("events not closed")
+	}
+}
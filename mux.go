@@ -0,0 +1,197 @@
+package gpio
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"zappem.net/pub/io/iotracer"
+)
+
+// Tee is a tracer that forwards every sample to each of its tracers.
+// It permits a single source to feed several tracers at once.
+type Tee []TimedTracer
+
+// TimedSample forwards a sample to all of the tracers.
+func (t Tee) TimedSample(when time.Time, src Named, mask, value uint64) {
+	for _, tr := range t {
+		tr.TimedSample(when, src, mask, value)
+	}
+}
+
+// TimedSampleNum forwards a Vector value to all of the tracers that
+// implement TimedNumTracer.
+func (t Tee) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	for _, tr := range t {
+		if n, ok := tr.(TimedNumTracer); ok {
+			n.TimedSampleNum(when, src, index, value)
+		}
+	}
+}
+
+// Annotate forwards an annotation to all of the tracers that are
+// Annotators.
+func (t Tee) Annotate(when time.Time, src Named, text string) {
+	for _, tr := range t {
+		if a, ok := tr.(Annotator); ok {
+			a.Annotate(when, src, text)
+		}
+	}
+}
+
+// Flush flushes all of the tracers that are Flushers. The first error
+// encountered is returned.
+func (t Tee) Flush() error {
+	var err error
+	for _, tr := range t {
+		if f, ok := tr.(Flusher); ok {
+			if e := f.Flush(); err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// LabelLine forwards a line label to all of the tracers that accept
+// labels. The first error encountered is returned.
+func (t Tee) LabelLine(src Named, index int, label string) error {
+	var err error
+	for _, tr := range t {
+		var e error
+		switch l := tr.(type) {
+		case SourceLabeler:
+			e = l.LabelLine(src, index, label)
+		case Labeler:
+			e = l.Label(index, label)
+		}
+		if err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// muxSource holds the traces recorded for a single source.
+type muxSource struct {
+	trace *iotracer.Trace
+	nums  *NumTrace
+
+	// bits and values indicate which of the traces has been
+	// sampled.
+	bits, values bool
+}
+
+// Mux is a tracer that records samples from several sources, Banks,
+// Flags and Vectors, into a single trace. Each source is recorded in
+// its own module namespace, but all share a common time base.
+type Mux struct {
+	app     string
+	samples uint
+
+	// mu protects srcs, order and the sampled state of each
+	// source.
+	mu    sync.Mutex
+	srcs  map[Named]*muxSource
+	order []*muxSource
+}
+
+// NewMux returns a multiplexing tracer named app. The trace of each
+// source holds up to samples recent samples.
+func NewMux(app string, samples uint) *Mux {
+	if samples == 0 {
+		return nil
+	}
+	return &Mux{
+		app:     app,
+		samples: samples,
+		srcs:    make(map[Named]*muxSource),
+	}
+}
+
+// sourceLocked returns the traces of src, adding them if needed. The
+// default module name for a source is "src<n>".
+func (m *Mux) sourceLocked(src Named) *muxSource {
+	s, ok := m.srcs[src]
+	if !ok {
+		module := fmt.Sprintf("src%d", len(m.order))
+		s = &muxSource{
+			trace: iotracer.NewTrace(m.app, m.samples),
+			nums:  NewNumTrace(m.app, m.samples),
+		}
+		s.trace.Module(module)
+		s.nums.Module(module)
+		m.srcs[src] = s
+		m.order = append(m.order, s)
+	}
+	return s
+}
+
+// Add registers src with the multiplexer using module as its
+// namespace. Sources that are not explicitly added are recorded with
+// default namespaces.
+func (m *Mux) Add(src Named, module string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.sourceLocked(src)
+	s.trace.Module(module)
+	s.nums.Module(module)
+}
+
+// LabelLine names a line of src in the trace.
+func (m *Mux) LabelLine(src Named, index int, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.sourceLocked(src)
+	if _, ok := src.(*Vector); ok {
+		return s.nums.Label(index, label)
+	}
+	return s.trace.Label(index, label)
+}
+
+// TimedSample records a sample from src.
+func (m *Mux) TimedSample(when time.Time, src Named, mask, value uint64) {
+	m.mu.Lock()
+	s := m.sourceLocked(src)
+	s.bits = true
+	m.mu.Unlock()
+	s.trace.SampleAt(when, mask, value)
+}
+
+// TimedSampleNum records a Vector value from src.
+func (m *Mux) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	m.mu.Lock()
+	s := m.sourceLocked(src)
+	s.values = true
+	m.mu.Unlock()
+	s.nums.SampleNumAt(when, index, value)
+}
+
+// VCD generates a Value Change Dump of all of the sources recorded so
+// far.
+func (m *Mux) VCD(tScale time.Duration) (io.Reader, error) {
+	m.mu.Lock()
+	var traces []*iotracer.Trace
+	var nums []*NumTrace
+	for _, s := range m.order {
+		if s.bits {
+			traces = append(traces, s.trace)
+		}
+		if s.values {
+			nums = append(nums, s.nums)
+		}
+	}
+	m.mu.Unlock()
+
+	ch, err := ExportVCD(m.app, tScale, traces, nums...)
+	if err != nil {
+		return nil, err
+	}
+	w := &bytes.Buffer{}
+	for line := range ch {
+		fmt.Fprintln(w, line)
+	}
+	return w, nil
+}
@@ -0,0 +1,52 @@
+package gpio
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMux(t *testing.T) {
+	m := NewMux("test", 20)
+	f1, f2 := NewFlag(), NewFlag()
+	v := NewVector(1)
+	m.Add(f1, "alpha")
+	m.Add(f2, "beta")
+	m.Add(v, "gamma")
+	m.LabelLine(f1, 1, "ready")
+	m.LabelLine(v, 0, "count")
+
+	r := &timedRecorder{}
+	f1.SetTimedTracer(Tee{m, r})
+	f2.SetTimedTracer(m)
+	v.SetTimedTracer(m)
+
+	f1.Set(1, true)
+	f1.Set(0, true)
+	f2.Set(2, true)
+	f2.Set(3, true)
+	v.Set(0, 5)
+	f1.Get(0)
+	if r.src != f1 || r.value != 3 {
+		t.Errorf("tee did not forward: got src=%p value=%x", r.src, r.value)
+	}
+
+	rd, err := m.VCD(1000)
+	if err != nil {
+		t.Fatalf("failed to generate VCD: %v", err)
+	}
+	data, _ := io.ReadAll(rd)
+	dump := string(data)
+	for _, want := range []string{
+		"$scope module alpha $end",
+		"$scope module beta $end",
+		"$scope module gamma $end",
+		" ready $end",
+		"$var integer 64 ",
+		" count $end",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("VCD dump is missing %q:\n%s", want, dump)
+		}
+	}
+}
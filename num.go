@@ -4,17 +4,27 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"time"
 )
 
+// NumTracer holds an optional tracing interface for Vector value
+// changes.
+type NumTracer interface {
+	// SampleNum records the new value of an indexed Vector value.
+	SampleNum(index int, value int64)
+}
+
 // Vector is an array of int64 values. Access to this vector is via
 // two methods Get() and SetHold(). This API mirrors that of the
 // (gpio) Bank and Flag arrays.
 type Vector struct {
-	mu sync.Mutex
+	seq uint64
+	mu  sync.Mutex
 
-	alias string
-	val   []int64
-	setCh chan int64
+	alias  string
+	val    []int64
+	setCh  chan int64
+	tracer TimedNumTracer
 }
 
 // NewVector allocates a vector containing count numerical values all
@@ -80,7 +90,12 @@ func (v *Vector) SetHold(index int) (chan<- int64, error) {
 			select {
 			case num, ok := <-ch:
 				if ok {
-					v.val[index] = num
+					if old := v.val[index]; old != num {
+						v.val[index] = num
+						if v.tracer != nil {
+							v.tracer.TimedSampleNum(time.Now(), v, index, num)
+						}
+					}
 					// block until ch closed by caller.
 					for ok {
 						_, ok = <-ch
@@ -103,14 +118,14 @@ func (v *Vector) SetHold(index int) (chan<- int64, error) {
 func (v *Vector) Set(index int, value int64) error {
 	ch, err := v.SetHold(index)
 	if err != nil {
-		return nil
+		return err
 	}
 	ch <- value
 	close(ch)
 	return nil
 }
 
-// SetAlias sets a friendly name for the Flag array.
+// SetAlias sets a friendly name for the Vector array.
 func (v *Vector) SetAlias(name string) {
 	if v != nil {
 		v.mu.Lock()
@@ -131,3 +146,33 @@ func (v *Vector) Label(index int) string {
 	}
 	return fmt.Sprintf("<VECTOR[%d]>", index)
 }
+
+// Annotate records text in the timeline of the vector trace, if the
+// tracer is an Annotator.
+func (v *Vector) Annotate(text string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if a, ok := v.tracer.(Annotator); ok {
+		a.Annotate(time.Now(), v, text)
+	}
+}
+
+// SetTracer sets or clears (tracer = nil) the vector tracer. When set,
+// the tracer is sent a sample of every current value of the vector.
+func (v *Vector) SetTracer(tracer NumTracer) {
+	v.SetTimedTracer(TimedNum(tracer))
+}
+
+// SetTimedTracer sets or clears (tracer = nil) the timestamped vector
+// tracer.
+func (v *Vector) SetTimedTracer(tracer TimedNumTracer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tracer = tracer
+	if tracer != nil {
+		now := time.Now()
+		for i, num := range v.val {
+			tracer.TimedSampleNum(now, v, i, num)
+		}
+	}
+}
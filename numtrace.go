@@ -0,0 +1,332 @@
+package gpio
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"zappem.net/pub/io/iotracer"
+)
+
+// numSample holds a single recorded Vector value.
+type numSample struct {
+	when  time.Time
+	index int
+	value int64
+}
+
+// NumTrace holds a circular buffer of recorded Vector values. It
+// implements the NumTracer interface and, via ExportVCD(), includes
+// the recorded values as integer or real variables alongside the
+// signals of iotracer traces.
+type NumTrace struct {
+	// app names the subsystem making the trace.
+	app string
+
+	// module names the signal root. If this is empty, it is
+	// reported as "values".
+	module string
+
+	// mu protects the following entries.
+	mu sync.Mutex
+
+	// samples holds a circular buffer of maxSamples values with
+	// cursor counting all of the samples ever recorded.
+	samples    []numSample
+	maxSamples uint
+	cursor     uint
+
+	// labels holds the preferred labels for each index. The
+	// default label for an index, n, is val<n>.
+	labels map[int]string
+
+	// scales holds the scale factors for indices that are to be
+	// reported as real variables.
+	scales map[int]float64
+}
+
+// NewNumTrace allocates a numerical tracer capable of storing up to
+// samples recent values.
+func NewNumTrace(app string, samples uint) *NumTrace {
+	if samples == 0 {
+		return nil
+	}
+	if app == "" {
+		app = "iotracer"
+	}
+	return &NumTrace{
+		app:        app,
+		samples:    make([]numSample, samples),
+		maxSamples: samples,
+		labels:     make(map[int]string),
+		scales:     make(map[int]float64),
+	}
+}
+
+// Module sets the trace module name used to group the variables in
+// the VCD dump. The default is "values".
+func (t *NumTrace) Module(name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.module = name
+}
+
+// Label names a specific index with a text label. If label="", the
+// label reverts to its default value: "val#".
+func (t *NumTrace) Label(index int, label string) error {
+	if t == nil || index < 0 {
+		return fmt.Errorf("invalid value index %d", index)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if label == "" {
+		delete(t.labels, index)
+	} else {
+		t.labels[index] = label
+	}
+	return nil
+}
+
+// Real arranges for the indexed value to be reported as a real
+// variable with the value value*scale. A scale of 0 reverts to
+// reporting the value as an integer.
+func (t *NumTrace) Real(index int, scale float64) error {
+	if t == nil || index < 0 {
+		return fmt.Errorf("invalid value index %d", index)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if scale == 0 {
+		delete(t.scales, index)
+	} else {
+		t.scales[index] = scale
+	}
+	return nil
+}
+
+// SampleNumAt records a value for an index at the specified time.
+func (t *NumTrace) SampleNumAt(now time.Time, index int, value int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	datum := &t.samples[t.cursor%t.maxSamples]
+	datum.when = now
+	datum.index = index
+	datum.value = value
+	t.cursor++
+}
+
+// SampleNum records a value for an index at the current time.
+func (t *NumTrace) SampleNum(index int, value int64) {
+	t.SampleNumAt(time.Now(), index, value)
+}
+
+// numDetail holds a snapshot of a NumTrace for VCD generation.
+type numDetail struct {
+	app, module string
+	working     []numSample
+	indices     []int
+	labels      map[int]string
+	scales      map[int]float64
+}
+
+// snapshot copies the recorded values in time order, along with the
+// labels and scales of the recorded indices.
+func (t *NumTrace) snapshot() *numDetail {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := &numDetail{
+		app:    t.app,
+		module: t.module,
+		labels: make(map[int]string),
+		scales: make(map[int]float64),
+	}
+	if d.module == "" {
+		d.module = "values"
+	}
+	n := t.cursor
+	if n > t.maxSamples {
+		n = t.maxSamples
+	}
+	for i := t.cursor - n; i < t.cursor; i++ {
+		s := t.samples[i%t.maxSamples]
+		d.working = append(d.working, s)
+		if _, ok := d.labels[s.index]; !ok {
+			d.labels[s.index] = t.labels[s.index]
+			d.indices = append(d.indices, s.index)
+		}
+	}
+	sort.Ints(d.indices)
+	for _, index := range d.indices {
+		if d.labels[index] == "" {
+			d.labels[index] = fmt.Sprintf("val%d", index)
+		}
+		if scale := t.scales[index]; scale != 0 {
+			d.scales[index] = scale
+		}
+	}
+	return d
+}
+
+// exported stands in for the source of the variables of a single
+// scope of the traces combined by ExportVCD().
+type exported struct {
+	lines int
+}
+
+func (e *exported) Lines() int             { return e.lines }
+func (e *exported) Label(index int) string { return fmt.Sprintf("<EXPORTED[%d]>", index) }
+func (e *exported) SetAlias(name string)   {}
+
+// exportModule returns the VCD scope name used for the variables of
+// a trace made by app and grouped under module.
+func exportModule(dumper, app, module string) string {
+	if app == dumper {
+		return module
+	}
+	return app + "_" + module
+}
+
+// ioChanges converts the value changes of an iotracer trace into
+// Changes of stand-in sources added to vw, one for each scope of the
+// trace.
+func ioChanges(vw *VCDWriter, dumper string, tScale time.Duration, tr *iotracer.Trace) ([]Change, error) {
+	ch, err := iotracer.ExportVCD(dumper, tScale, tr)
+	if err == iotracer.ErrNoTraceData {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for line := range ch {
+		lines = append(lines, line)
+	}
+	v, err := ReadVCD(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("bad iotracer VCD: %v", err)
+	}
+	start := v.Start
+	if start.IsZero() {
+		return nil, fmt.Errorf("bad iotracer date: %q", v.Date)
+	}
+
+	type line struct {
+		src    *exported
+		module string
+		index  int
+	}
+	vars := make([]line, len(v.Vars))
+	scopes := make(map[string]*exported)
+	var modules []string
+	for i, vv := range v.Vars {
+		module := strings.Join(vv.Scope, "_")
+		if n := len(vv.Scope); n >= 2 {
+			module = exportModule(dumper, vv.Scope[n-2], vv.Scope[n-1])
+		}
+		src := scopes[module]
+		if src == nil {
+			src = &exported{}
+			scopes[module] = src
+			modules = append(modules, module)
+		}
+		vars[i] = line{src: src, module: module, index: src.lines}
+		src.lines++
+	}
+	for _, module := range modules {
+		vw.Add(scopes[module], module)
+	}
+	for i, l := range vars {
+		vw.LabelLine(l.src, l.index, v.Vars[i].Name)
+	}
+	var chs []Change
+	for _, e := range v.Events {
+		if e.Var < 0 || !e.Known {
+			continue
+		}
+		l := vars[e.Var]
+		chs = append(chs, Change{
+			When:   start.Add(e.At),
+			Source: l.src,
+			Module: l.module,
+			Index:  l.index,
+			Label:  v.Vars[e.Var].Name,
+			New:    e.Value,
+		})
+	}
+	return chs, nil
+}
+
+// ExportVCD generates a single VCD dump from a set of concurrent
+// iotracer traces and numerical traces. It extends
+// iotracer.ExportVCD() by adding the recorded Vector values as
+// integer, or real, variables. The argument dumper names the
+// collection of traces and tScale indicates what a count of 1 means
+// in the counter output.
+func ExportVCD(dumper string, tScale time.Duration, traces []*iotracer.Trace, nums ...*NumTrace) (<-chan string, error) {
+	buf := &bytes.Buffer{}
+	vw := NewVCDWriter(buf, dumper, tScale, 0)
+	var chs []Change
+	for _, tr := range traces {
+		ios, err := ioChanges(vw, dumper, tScale, tr)
+		if err != nil {
+			return nil, err
+		}
+		chs = append(chs, ios...)
+	}
+	for _, t := range nums {
+		if t == nil {
+			continue
+		}
+		d := t.snapshot()
+		if len(d.working) == 0 {
+			continue
+		}
+		module := exportModule(dumper, d.app, d.module)
+		src := &exported{lines: len(d.indices)}
+		vw.Add(src, module)
+		lines := make(map[int]int)
+		for i, index := range d.indices {
+			lines[index] = i
+			vw.LabelLine(src, i, d.labels[index])
+			if scale := d.scales[index]; scale != 0 {
+				vw.scales[vcdVar{src: src, index: i}] = scale
+			}
+		}
+		for _, s := range d.working {
+			chs = append(chs, Change{
+				When:    s.when,
+				Source:  src,
+				Module:  module,
+				Index:   lines[s.index],
+				Label:   d.labels[s.index],
+				New:     s.value,
+				Numeric: true,
+			})
+		}
+	}
+	if len(chs) == 0 {
+		return nil, iotracer.ErrNoTraceData
+	}
+	sort.SliceStable(chs, func(i, j int) bool { return chs[i].When.Before(chs[j].When) })
+	vw.record(chs)
+	if err := vw.Flush(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			ch <- line
+		}
+	}()
+	return ch, nil
+}
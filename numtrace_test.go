@@ -0,0 +1,47 @@
+package gpio
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"zappem.net/pub/io/iotracer"
+)
+
+func TestNumTrace(t *testing.T) {
+	tr := iotracer.NewTrace("test", 10)
+	nt := NewNumTrace("test", 10)
+	nt.Label(1, "count")
+	nt.Real(2, 0.5)
+
+	start := time.Now()
+	tr.SampleAt(start, 3, 0)
+	v := NewVector(3)
+	v.SetTracer(nt)
+	v.Set(1, 42)
+	v.Set(2, 3)
+	tr.SampleAt(start.Add(time.Millisecond), 3, 1)
+
+	ch, err := ExportVCD("test", time.Microsecond, []*iotracer.Trace{tr}, nt)
+	if err != nil {
+		t.Fatalf("failed to export VCD: %v", err)
+	}
+	var lines []string
+	for line := range ch {
+		lines = append(lines, line)
+	}
+	dump := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"$var wire 1 ! sig0 $end",
+		"$var integer 64 # val0 $end",
+		"$var integer 64 $ count $end",
+		"$var real 64 % val2 $end",
+		"b101010 $",
+		"r1.5 %",
+		"#1000\n1!",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("VCD dump is missing %q:\n%s", want, dump)
+		}
+	}
+}
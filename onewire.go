@@ -0,0 +1,519 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// These are the errors reported by the 1-Wire bus master.
+var (
+	ErrNoDevice = errors.New("no 1-Wire device present")
+	ErrCRC      = errors.New("CRC mismatch")
+)
+
+// These are the standard speed 1-Wire timings used by OneWire.
+const (
+	// owResetLow is the duration of a reset pulse, and owPresence
+	// the time after it when presence is sampled. owResetHigh is
+	// the time the bus is released after a reset pulse.
+	owResetLow  = 480 * time.Microsecond
+	owPresence  = 70 * time.Microsecond
+	owResetHigh = 480 * time.Microsecond
+
+	// owSlot is the duration of a bit slot, and owRecovery the gap
+	// between slots. A one is written, or a bit read, with a low
+	// pulse of owShortLow, and a zero with a low pulse of owLongLow.
+	// A read bit is sampled owSample after the start of the slot.
+	owSlot     = 65 * time.Microsecond
+	owRecovery = 5 * time.Microsecond
+	owShortLow = 6 * time.Microsecond
+	owLongLow  = 60 * time.Microsecond
+	owSample   = 15 * time.Microsecond
+
+	// owEdgeLatency bounds the delivery delay of an edge.
+	owEdgeLatency = 10 * time.Millisecond
+)
+
+// These are the 1-Wire ROM commands.
+const (
+	owSearchROM = 0xf0
+	owMatchROM  = 0x55
+	owSkipROM   = 0xcc
+)
+
+// OneWireROM is the 64-bit ROM code of a 1-Wire device. The low byte
+// holds the family code, the next six bytes the serial number and the
+// high byte the CRC8 of the others.
+type OneWireROM uint64
+
+// Family returns the family code of the device.
+func (r OneWireROM) Family() byte {
+	return byte(r)
+}
+
+// bytes returns the ROM code in transmission order.
+func (r OneWireROM) bytes() []byte {
+	b := make([]byte, 8)
+	for i := range b {
+		b[i] = byte(r >> (8 * i))
+	}
+	return b
+}
+
+// Valid confirms the CRC8 of the ROM code.
+func (r OneWireROM) Valid() bool {
+	return CRC8(r.bytes()[:7]) == byte(r>>56)
+}
+
+// String formats the ROM code in the style of the Linux w1 driver, as
+// the family code and the serial number, for example
+// "28-00000a1b2c3d".
+func (r OneWireROM) String() string {
+	return fmt.Sprintf("%02x-%012x", byte(r), uint64(r)>>8&(1<<48-1))
+}
+
+// CRC8 computes the Dallas/Maxim CRC8 (polynomial x^8+x^5+x^4+1) used
+// by 1-Wire devices for ROM codes and data.
+func CRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			mix := (crc ^ b) & 1
+			crc >>= 1
+			if mix != 0 {
+				crc ^= 0x8c
+			}
+			b >>= 1
+		}
+	}
+	return crc
+}
+
+// OneWire is a bit-banged 1-Wire bus master. The dq line must be open
+// drain, with a pull-up, so that devices can pull it low: for a Bank,
+// configure it with LineFlagOpenDrain|LineFlagBiasPullUp and enable
+// it as an output. The bus level is read from the sense line, which
+// can be dq itself. If the sense line can be watched, for example a
+// Bank input wired to the bus, the bits are measured from the
+// timestamps of its edges, which tolerates scheduling delays better
+// than sampling the line.
+type OneWire struct {
+	io        IO[bool]
+	dq, sense int
+	edges     <-chan Edge
+	cancel    context.CancelFunc
+
+	// clock, if non-nil, replaces the real time.
+	clock clock
+
+	// mu serializes bus operations.
+	mu sync.Mutex
+}
+
+// NewOneWire returns a 1-Wire bus master using the dq and sense lines
+// of io, which are watched until ctx is done or Close() is called.
+// The dq line is released.
+func NewOneWire(ctx context.Context, io IO[bool], dq, sense int) (*OneWire, error) {
+	w := &OneWire{
+		io:    io,
+		dq:    dq,
+		sense: sense,
+	}
+	if err := io.Set(dq, true); err != nil {
+		return nil, err
+	}
+	if wt, ok := io.(Watcher); ok {
+		ctx, cancel := context.WithCancel(ctx)
+		if edges, err := wt.Watch(ctx, sense); err == nil {
+			w.edges, w.cancel = edges, cancel
+		} else {
+			// Fall back to sampling the line.
+			cancel()
+		}
+	}
+	return w, nil
+}
+
+// Close stops watching the sense line.
+func (w *OneWire) Close() error {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	return nil
+}
+
+// pacer returns a pacer started at the current time.
+func (w *OneWire) pacer() *pacer {
+	p := &pacer{clock: w.clock}
+	p.start()
+	return p
+}
+
+// drain discards the edges that have been delivered.
+func (w *OneWire) drain() {
+	for {
+		select {
+		case <-w.edges:
+		default:
+			return
+		}
+	}
+}
+
+// nextEdge returns the next edge to the level on at or after since.
+func (w *OneWire) nextEdge(since time.Time, on bool) (Edge, bool) {
+	timeout := time.NewTimer(owEdgeLatency)
+	defer timeout.Stop()
+	for {
+		select {
+		case e, ok := <-w.edges:
+			if !ok {
+				return Edge{}, false
+			}
+			if e.On == on && !e.When.Before(since) {
+				return e, true
+			}
+		case <-timeout.C:
+			return Edge{}, false
+		}
+	}
+}
+
+// reset sends a reset pulse and reports whether any device responded
+// with a presence pulse.
+func (w *OneWire) reset(p *pacer) (bool, error) {
+	w.drain()
+	if err := w.io.Set(w.dq, false); err != nil {
+		return false, err
+	}
+	p.wait(owResetLow)
+	released := p.now()
+	if err := w.io.Set(w.dq, true); err != nil {
+		return false, err
+	}
+	var present bool
+	if w.edges == nil {
+		p.wait(owPresence)
+		on, err := w.io.Get(w.sense)
+		if err != nil {
+			return false, err
+		}
+		present = !on
+		p.wait(owResetHigh - owPresence)
+	} else {
+		p.wait(owResetHigh)
+		if rise, ok := w.nextEdge(released, true); ok {
+			_, present = w.nextEdge(rise.When, false)
+		}
+	}
+	if on, err := w.io.Get(w.sense); err != nil {
+		return false, err
+	} else if !on {
+		return false, ErrBusStuck
+	}
+	return present, nil
+}
+
+// bit performs a bit slot, writing a zero if !on. A slot writing a one
+// is also a read slot, and the bit read is returned.
+func (w *OneWire) bit(p *pacer, on bool) (bool, error) {
+	w.drain()
+	low := owLongLow
+	if on {
+		low = owShortLow
+	}
+	start := p.now()
+	if err := w.io.Set(w.dq, false); err != nil {
+		return false, err
+	}
+	p.wait(low)
+	if err := w.io.Set(w.dq, true); err != nil {
+		return false, err
+	}
+	var got bool
+	if !on {
+		p.wait(owSlot - low)
+	} else if w.edges == nil {
+		p.wait(owSample - low)
+		var err error
+		if got, err = w.io.Get(w.sense); err != nil {
+			return false, err
+		}
+		p.wait(owSlot - owSample)
+	} else {
+		p.wait(owSlot - low)
+		fall, ok := w.nextEdge(start, false)
+		if !ok {
+			return false, fmt.Errorf("1-Wire line %q did not fall", w.io.Label(w.sense))
+		}
+		rise, ok := w.nextEdge(fall.When, true)
+		if !ok {
+			return false, ErrBusStuck
+		}
+		got = rise.When.Sub(fall.When) < owSample
+	}
+	p.wait(owRecovery)
+	return got, nil
+}
+
+// writeByte writes a byte, least significant bit first.
+func (w *OneWire) writeByte(p *pacer, b byte) error {
+	for i := 0; i < 8; i++ {
+		if _, err := w.bit(p, b>>i&1 != 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readByte reads a byte, least significant bit first.
+func (w *OneWire) readByte(p *pacer) (byte, error) {
+	var b byte
+	for i := 0; i < 8; i++ {
+		on, err := w.bit(p, true)
+		if err != nil {
+			return 0, err
+		}
+		if on {
+			b |= 1 << i
+		}
+	}
+	return b, nil
+}
+
+// tx writes the bytes of wr and then reads the bytes of rd.
+func (w *OneWire) tx(p *pacer, wr, rd []byte) error {
+	for _, b := range wr {
+		if err := w.writeByte(p, b); err != nil {
+			return err
+		}
+	}
+	for i := range rd {
+		b, err := w.readByte(p)
+		if err != nil {
+			return err
+		}
+		rd[i] = b
+	}
+	return nil
+}
+
+// selectROM resets the bus and addresses the device with ROM code rom,
+// or all devices if rom is zero.
+func (w *OneWire) selectROM(p *pacer, rom OneWireROM) error {
+	present, err := w.reset(p)
+	if err != nil {
+		return err
+	}
+	if !present {
+		return ErrNoDevice
+	}
+	if rom == 0 {
+		return w.writeByte(p, owSkipROM)
+	}
+	return w.tx(p, append([]byte{owMatchROM}, rom.bytes()...), nil)
+}
+
+// Reset sends a reset pulse and reports whether any device responded
+// with a presence pulse.
+func (w *OneWire) Reset() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.reset(w.pacer())
+}
+
+// WriteBit writes a single bit.
+func (w *OneWire) WriteBit(on bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.bit(w.pacer(), on)
+	return err
+}
+
+// ReadBit reads a single bit.
+func (w *OneWire) ReadBit() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.bit(w.pacer(), true)
+}
+
+// WriteByte writes a byte, least significant bit first.
+func (w *OneWire) WriteByte(b byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writeByte(w.pacer(), b)
+}
+
+// ReadByte reads a byte, least significant bit first.
+func (w *OneWire) ReadByte() (byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.readByte(w.pacer())
+}
+
+// Tx addresses the device with ROM code rom, or all devices if rom is
+// zero, writes the bytes of wr, typically a function command, and then
+// fills rd with the bytes read from the device.
+func (w *OneWire) Tx(rom OneWireROM, wr, rd []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p := w.pacer()
+	if err := w.selectROM(p, rom); err != nil {
+		return err
+	}
+	return w.tx(p, wr, rd)
+}
+
+// Search returns the ROM codes of all the devices on the bus, using
+// the ROM search algorithm. A ROM code with a bad CRC8 reports
+// ErrCRC.
+func (w *OneWire) Search() ([]OneWireROM, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var roms []OneWireROM
+	var rom OneWireROM
+	// last is the bit position of the most recent discrepancy at
+	// which the zero branch was taken.
+	last := -1
+	for {
+		p := w.pacer()
+		present, err := w.reset(p)
+		if err != nil {
+			return roms, err
+		}
+		if !present {
+			return roms, nil
+		}
+		if err := w.writeByte(p, owSearchROM); err != nil {
+			return roms, err
+		}
+		zero := -1
+		for i := 0; i < 64; i++ {
+			a, err := w.bit(p, true)
+			if err != nil {
+				return roms, err
+			}
+			b, err := w.bit(p, true)
+			if err != nil {
+				return roms, err
+			}
+			var dir bool
+			switch {
+			case a && b:
+				return roms, fmt.Errorf("1-Wire search lost all devices at bit %d", i)
+			case a != b:
+				dir = a
+			case i < last:
+				dir = rom>>i&1 != 0
+			default:
+				dir = i == last
+			}
+			if !a && !b && !dir {
+				zero = i
+			}
+			if dir {
+				rom |= 1 << i
+			} else {
+				rom &^= 1 << i
+			}
+			if _, err := w.bit(p, dir); err != nil {
+				return roms, err
+			}
+		}
+		if !rom.Valid() {
+			return roms, fmt.Errorf("1-Wire ROM %v: %w", rom, ErrCRC)
+		}
+		roms = append(roms, rom)
+		if last = zero; last < 0 {
+			return roms, nil
+		}
+	}
+}
+
+// These are the DS18B20 function commands.
+const (
+	ds18b20Convert        = 0x44
+	ds18b20ReadScratchpad = 0xbe
+)
+
+// DS18B20FamilyCode is the ROM family code of DS18B20 sensors.
+const DS18B20FamilyCode = 0x28
+
+// ds18b20Timeout bounds the duration of a temperature conversion.
+const ds18b20Timeout = time.Second
+
+// DS18B20 is a 1-Wire temperature sensor.
+type DS18B20 struct {
+	bus *OneWire
+	rom OneWireROM
+}
+
+// NewDS18B20 returns the DS18B20 sensor with ROM code rom on a 1-Wire
+// bus. If rom is zero, the sensor must be the only device on the bus.
+func NewDS18B20(bus *OneWire, rom OneWireROM) *DS18B20 {
+	return &DS18B20{bus: bus, rom: rom}
+}
+
+// Read performs a temperature conversion and returns the temperature
+// in thousandths of a degree Celsius.
+func (d *DS18B20) Read() (int64, error) {
+	w := d.bus
+	if err := w.Tx(d.rom, []byte{ds18b20Convert}, nil); err != nil {
+		return 0, err
+	}
+	// The sensor holds read slots low until the conversion is
+	// complete. The bus is released between polls.
+	deadline := time.Now().Add(ds18b20Timeout)
+	for {
+		done, err := w.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("DS18B20 %v conversion timed out", d.rom)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	sp := make([]byte, 9)
+	if err := w.Tx(d.rom, []byte{ds18b20ReadScratchpad}, sp); err != nil {
+		return 0, err
+	}
+	if CRC8(sp[:8]) != sp[8] {
+		return 0, fmt.Errorf("DS18B20 %v scratchpad: %w", d.rom, ErrCRC)
+	}
+	raw := int16(sp[0]) | int16(sp[1])<<8
+	return int64(raw) * 1000 / 16, nil
+}
+
+// Publish reads the temperature and sets it, in thousandths of a
+// degree Celsius, as the indexed value of v, for example a Vector.
+func (d *DS18B20) Publish(v IO[int64], index int) error {
+	t, err := d.Read()
+	if err != nil {
+		return err
+	}
+	return v.Set(index, t)
+}
+
+// Poll publishes the temperature every period until ctx is done, or a
+// reading fails.
+func (d *DS18B20) Poll(ctx context.Context, v IO[int64], index int, period time.Duration) error {
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		if err := d.Publish(v, index); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+// These are the modes of a simulated 1-Wire device.
+const (
+	owIdle = iota
+	owROM
+	owMatch
+	owSearch
+	owFunc
+	owSend
+	owConvert
+)
+
+// owDevice simulates a 1-Wire device. Devices in the DS18B20 family
+// support temperature conversion and reading the scratchpad.
+type owDevice struct {
+	rom     OneWireROM
+	scratch []byte
+
+	mode int
+	n    int
+	step int
+	rx   uint64
+	tx   []bool
+
+	// converting counts the read slots until a conversion is done.
+	converting int
+}
+
+// output returns the bit the device sends in the next slot.
+func (d *owDevice) output() bool {
+	switch d.mode {
+	case owSend:
+		return d.tx[0]
+	case owSearch:
+		bit := d.rom>>d.n&1 != 0
+		switch d.step {
+		case 0:
+			return bit
+		case 1:
+			return !bit
+		}
+	case owConvert:
+		return d.converting == 0
+	}
+	return true
+}
+
+// receive accumulates a bit, returning true once n bits are held.
+func (d *owDevice) receive(bus bool, n int) bool {
+	if bus {
+		d.rx |= 1 << d.n
+	}
+	d.n++
+	return d.n == n
+}
+
+// send queues bytes to send, least significant bit first.
+func (d *owDevice) send(bs []byte) {
+	d.mode, d.tx = owSend, nil
+	for _, b := range bs {
+		for i := 0; i < 8; i++ {
+			d.tx = append(d.tx, b>>i&1 != 0)
+		}
+	}
+}
+
+// slot advances the device state with the bus level of a slot.
+func (d *owDevice) slot(bus bool) {
+	switch d.mode {
+	case owROM:
+		if !d.receive(bus, 8) {
+			return
+		}
+		d.n = 0
+		switch d.rx {
+		case owMatchROM:
+			d.mode, d.rx = owMatch, 0
+		case owSkipROM:
+			d.mode, d.rx = owFunc, 0
+		case owSearchROM:
+			d.mode, d.step = owSearch, 0
+		case 0x33:
+			d.send(d.rom.bytes())
+		default:
+			d.mode = owIdle
+		}
+	case owMatch:
+		if !d.receive(bus, 64) {
+			return
+		}
+		d.mode = owIdle
+		if OneWireROM(d.rx) == d.rom {
+			d.mode, d.n, d.rx = owFunc, 0, 0
+		}
+	case owSearch:
+		if d.step < 2 {
+			d.step++
+			return
+		}
+		if bus != (d.rom>>d.n&1 != 0) {
+			d.mode = owIdle
+			return
+		}
+		d.step = 0
+		if d.n++; d.n == 64 {
+			d.mode, d.n, d.rx = owFunc, 0, 0
+		}
+	case owFunc:
+		if !d.receive(bus, 8) {
+			return
+		}
+		switch {
+		case d.scratch == nil:
+			d.mode = owIdle
+		case d.rx == ds18b20Convert:
+			d.mode, d.converting = owConvert, 3
+		case d.rx == ds18b20ReadScratchpad:
+			d.send(d.scratch)
+		default:
+			d.mode = owIdle
+		}
+	case owSend:
+		if d.tx = d.tx[1:]; len(d.tx) == 0 {
+			d.mode = owIdle
+		}
+	case owConvert:
+		if d.converting > 0 {
+			d.converting--
+		}
+	}
+}
+
+// owSim simulates a 1-Wire bus with a virtual clock, advanced by the
+// waits of the bus master. It implements IO[bool], with line 0 as dq,
+// and, if watch is set, Watcher.
+type owSim struct {
+	at       time.Time
+	released bool
+	fell     time.Time
+	out      bool
+	stuck    bool
+	watch    bool
+	ch       chan Edge
+
+	// pullUntil is the end of a zero sent by a device, and presence
+	// the start of a presence pulse.
+	pullUntil, presence time.Time
+
+	devs []*owDevice
+}
+
+func newOWSim(watch bool, devs ...*owDevice) *owSim {
+	return &owSim{
+		at:       time.Now(),
+		released: true,
+		watch:    watch,
+		devs:     devs,
+	}
+}
+
+func (s *owSim) now() time.Time { return s.at }
+
+func (s *owSim) sleepUntil(t time.Time) {
+	if t.After(s.at) {
+		s.at = t
+	}
+}
+
+func (s *owSim) Lines() int             { return 1 }
+func (s *owSim) Label(index int) string { return "dq" }
+func (s *owSim) SetAlias(name string)   {}
+func (s *owSim) SetHold(index int) (chan<- bool, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *owSim) Watch(ctx context.Context, index int) (<-chan Edge, error) {
+	if !s.watch {
+		return nil, errors.New("not supported")
+	}
+	s.ch = make(chan Edge, edgeDepth)
+	return s.ch, nil
+}
+
+// edge delivers an edge to the watcher.
+func (s *owSim) edge(at time.Time, on bool) {
+	if s.ch != nil {
+		s.ch <- Edge{When: at, On: on}
+	}
+}
+
+func (s *owSim) Get(index int) (bool, error) {
+	if s.stuck || !s.released || s.at.Before(s.pullUntil) {
+		return false, nil
+	}
+	pulse := s.presence.Add(120 * time.Microsecond)
+	return s.at.Before(s.presence) || !s.at.Before(pulse), nil
+}
+
+func (s *owSim) Set(index int, on bool) error {
+	if s.stuck || on == s.released {
+		return nil
+	}
+	s.released = on
+	if !on {
+		s.fell = s.at
+		s.out = true
+		for _, d := range s.devs {
+			s.out = s.out && d.output()
+		}
+		if !s.out {
+			s.pullUntil = s.at.Add(30 * time.Microsecond)
+		}
+		s.edge(s.at, false)
+		return nil
+	}
+	rise := s.at
+	if rise.Before(s.pullUntil) {
+		rise = s.pullUntil
+	}
+	s.edge(rise, true)
+	d := s.at.Sub(s.fell)
+	if d >= owResetLow {
+		for _, dev := range s.devs {
+			*dev = owDevice{rom: dev.rom, scratch: dev.scratch, mode: owROM}
+		}
+		if len(s.devs) != 0 {
+			s.presence = s.at.Add(30 * time.Microsecond)
+			s.edge(s.presence, false)
+			s.edge(s.presence.Add(120*time.Microsecond), true)
+		}
+		return nil
+	}
+	bus := d < owSample && s.out
+	for _, dev := range s.devs {
+		dev.slot(bus)
+	}
+	return nil
+}
+
+// makeROM returns a ROM code with a valid CRC8.
+func makeROM(family byte, serial uint64) OneWireROM {
+	r := OneWireROM(family) | OneWireROM(serial)<<8
+	return r | OneWireROM(CRC8(r.bytes()[:7]))<<56
+}
+
+// makeScratchpad returns a DS18B20 scratchpad holding a temperature in
+// sixteenths of a degree.
+func makeScratchpad(raw int16) []byte {
+	sp := []byte{byte(raw), byte(raw >> 8), 0x4b, 0x46, 0x7f, 0xff, 0x0c, 0x10, 0}
+	sp[8] = CRC8(sp[:8])
+	return sp
+}
+
+func TestCRC8(t *testing.T) {
+	// The example ROM code of Maxim application note 27.
+	if got := CRC8([]byte{0x02, 0x1c, 0xb8, 0x01, 0x00, 0x00, 0x00}); got != 0xa2 {
+		t.Errorf("CRC8 got 0x%02x, want 0xa2", got)
+	}
+	r := makeROM(DS18B20FamilyCode, 0x0a1b2c3d)
+	if !r.Valid() || r.Family() != DS18B20FamilyCode {
+		t.Errorf("bad ROM %016x", uint64(r))
+	}
+	if got, want := r.String(), "28-00000a1b2c3d"; got != want {
+		t.Errorf("ROM string got %q, want %q", got, want)
+	}
+}
+
+func TestOneWire(t *testing.T) {
+	for _, watch := range []bool{true, false} {
+		devs := []*owDevice{
+			{rom: makeROM(DS18B20FamilyCode, 0x0a1b2c3d), scratch: makeScratchpad(401)},
+			{rom: makeROM(DS18B20FamilyCode, 0x0a1b2c3c), scratch: makeScratchpad(-162)},
+			{rom: makeROM(0x01, 0x123456789abc)},
+		}
+		s := newOWSim(watch, devs...)
+		w, err := NewOneWire(context.Background(), s, 0, 0)
+		if err != nil {
+			t.Fatalf("NewOneWire failed: %v", err)
+		}
+		w.clock = s
+		if (w.edges != nil) != watch {
+			t.Fatalf("watching=%v, want %v", w.edges != nil, watch)
+		}
+
+		roms, err := w.Search()
+		if err != nil {
+			t.Fatalf("watch=%v: Search failed: %v", watch, err)
+		}
+		sort.Slice(roms, func(i, j int) bool { return roms[i] < roms[j] })
+		var want []OneWireROM
+		for _, d := range devs {
+			want = append(want, d.rom)
+		}
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		if len(roms) != len(want) {
+			t.Fatalf("watch=%v: Search found %v, want %v", watch, roms, want)
+		}
+		for i := range roms {
+			if roms[i] != want[i] {
+				t.Errorf("watch=%v: Search found %v, want %v", watch, roms, want)
+				break
+			}
+		}
+
+		v := NewVector(2)
+		for i, d := range devs[:2] {
+			if err := NewDS18B20(w, d.rom).Publish(v, i); err != nil {
+				t.Fatalf("watch=%v: Publish of %v failed: %v", watch, d.rom, err)
+			}
+		}
+		for i, want := range []int64{25062, -10125} {
+			if got, _ := v.Get(i); got != want {
+				t.Errorf("watch=%v: sensor %d got %d, want %d", watch, i, got, want)
+			}
+		}
+
+		devs[0].scratch[3] ^= 1
+		if _, err := NewDS18B20(w, devs[0].rom).Read(); !errors.Is(err, ErrCRC) {
+			t.Errorf("watch=%v: corrupt scratchpad returned %v", watch, err)
+		}
+		w.Close()
+	}
+
+	s := newOWSim(true)
+	w, _ := NewOneWire(context.Background(), s, 0, 0)
+	w.clock = s
+	if present, err := w.Reset(); present || err != nil {
+		t.Errorf("empty bus Reset returned %v, %v", present, err)
+	}
+	if _, err := NewDS18B20(w, 0).Read(); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("empty bus Read returned %v", err)
+	}
+	s.stuck = true
+	if _, err := w.Reset(); !errors.Is(err, ErrBusStuck) {
+		t.Errorf("stuck bus Reset returned %v", err)
+	}
+
+	// A single sensor can be read without its ROM code.
+	dev := &owDevice{rom: makeROM(DS18B20FamilyCode, 1), scratch: makeScratchpad(0x0550)}
+	s = newOWSim(false, dev)
+	w, _ = NewOneWire(context.Background(), s, 0, 0)
+	w.clock = s
+	if got, err := NewDS18B20(w, 0).Read(); err != nil || got != 85000 {
+		t.Errorf("single sensor Read returned %d, %v", got, err)
+	}
+	rom := make([]byte, 8)
+	if err := w.Tx(0, nil, nil); err != nil {
+		t.Fatalf("Tx failed: %v", err)
+	}
+	if present, err := w.Reset(); !present || err != nil {
+		t.Fatalf("Reset returned %v, %v", present, err)
+	}
+	w.WriteByte(0x33)
+	for i := range rom {
+		rom[i], _ = w.ReadByte()
+	}
+	if got := OneWireROM(uint64FromBytes(rom)); got != dev.rom {
+		t.Errorf("read ROM %v, want %v", got, dev.rom)
+	}
+}
+
+// uint64FromBytes assembles a little endian value.
+func uint64FromBytes(b []byte) uint64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
@@ -0,0 +1,57 @@
+package gpio
+
+import (
+	"runtime"
+	"time"
+)
+
+// clock supplies the time to a pacer. A nil clock is the real time.
+type clock interface {
+	now() time.Time
+	sleepUntil(t time.Time)
+}
+
+// pacer times the steps of a bit-banged protocol. It sleeps through
+// long waits, but spins for the final stretch of each wait since the
+// scheduler cannot wake a goroutine with microsecond accuracy.
+type pacer struct {
+	next  time.Time
+	clock clock
+}
+
+// spinThreshold is the remaining wait below which a pacer spins.
+const spinThreshold = time.Millisecond
+
+// now returns the time of the pacer clock.
+func (p *pacer) now() time.Time {
+	if p.clock != nil {
+		return p.clock.now()
+	}
+	return time.Now()
+}
+
+// start resets the pacer to the current time.
+func (p *pacer) start() {
+	p.next = p.now()
+}
+
+// wait advances the pacer by d and blocks until that time.
+func (p *pacer) wait(d time.Duration) {
+	p.next = p.next.Add(d)
+	if now := p.now(); p.next.Before(now) {
+		// Falling behind by more than a whole step: don't
+		// attempt to catch up, but don't cut this step short
+		// either.
+		p.next = now.Add(d)
+	}
+	if p.clock != nil {
+		p.clock.sleepUntil(p.next)
+		return
+	}
+	if d := time.Until(p.next); d > spinThreshold {
+		time.Sleep(d - spinThreshold)
+	}
+	for time.Now().Before(p.next) {
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,344 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PWMStats summarizes how accurately a PWM has placed its edges. The
+// lateness of each tick is measured from its scheduled time to just
+// before its values are committed.
+type PWMStats struct {
+	// Periods counts the periods started, and Ticks the line
+	// updates made within them.
+	Periods, Ticks uint64
+
+	// Overruns counts the ticks that were so late that the timing
+	// of the rest of the signal was restarted from them.
+	Overruns uint64
+
+	// Mean, StdDev and Max summarize the lateness of the ticks.
+	Mean, StdDev, Max time.Duration
+}
+
+// String summarizes the statistics on one line.
+func (s PWMStats) String() string {
+	return fmt.Sprintf("periods=%d ticks=%d overruns=%d jitter mean=%v stddev=%v max=%v",
+		s.Periods, s.Ticks, s.Overruns, s.Mean, s.StdDev, s.Max)
+}
+
+// PWM drives output lines with pulse width modulated signals of a
+// common frequency, from a dedicated goroutine. The channels are phase
+// aligned: each period starts with all channels that have a non-zero
+// duty cycle rising together, and each channel falls after its pulse
+// width. All of the lines that change at the same time are updated in
+// one transaction, so the lines of a Bank are set with a single kernel
+// call per tick.
+type PWM struct {
+	lines  []Line
+	period time.Duration
+
+	// clock, if non-nil, replaces the real time.
+	clock clock
+
+	// update, if non-nil, is called at the start of each period,
+	// before the pulse widths are adopted.
+	update func()
+
+	// mu protects all subsequent fields.
+	mu sync.Mutex
+
+	// widths holds the pulse widths of the channels, which are
+	// adopted at the start of each period.
+	widths []time.Duration
+
+	// stats accumulates the timing statistics, with sum and sumSq
+	// holding the sums of the lateness of ticks, and its squares,
+	// in nanoseconds.
+	stats      PWMStats
+	sum, sumSq float64
+
+	err    error
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPWM starts generating PWM signals at frequency hz on the output
+// lines. Each line is a channel, indexed in the order listed, which is
+// initially held low (a duty cycle of zero). The signals are generated
+// until ctx is done or Close() is called.
+func NewPWM(ctx context.Context, hz float64, lines ...Line) (*PWM, error) {
+	p, err := newPWM(hz, lines...)
+	if err != nil {
+		return nil, err
+	}
+	p.start(ctx)
+	return p, nil
+}
+
+// newPWM prepares a PWM without starting it.
+func newPWM(hz float64, lines ...Line) (*PWM, error) {
+	if hz <= 0 || math.IsInf(hz, 0) || math.IsNaN(hz) {
+		return nil, fmt.Errorf("invalid PWM frequency %v", hz)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("PWM requires at least one line")
+	}
+	period := time.Duration(float64(time.Second) / hz)
+	if period <= 0 {
+		return nil, fmt.Errorf("PWM frequency %v is too high", hz)
+	}
+	// Confirm the lines can be driven.
+	t, err := Hold(lines...)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if err := t.Set(l, false); err != nil {
+			t.Release()
+			return nil, err
+		}
+	}
+	if err := t.Commit(); err != nil {
+		return nil, err
+	}
+	return &PWM{
+		lines:  append([]Line(nil), lines...),
+		period: period,
+		widths: make([]time.Duration, len(lines)),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// start launches the goroutine that generates the signals.
+func (p *PWM) start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	go p.run(ctx)
+}
+
+// Period returns the PWM period.
+func (p *PWM) Period() time.Duration {
+	return p.period
+}
+
+// valid confirms ch is a channel index.
+func (p *PWM) valid(ch int) error {
+	if ch < 0 || ch >= len(p.lines) {
+		return fmt.Errorf("invalid PWM channel %d, want [0,%d)", ch, len(p.lines))
+	}
+	return nil
+}
+
+// SetWidth sets the pulse width of channel ch. The change takes effect
+// at the start of the next period, so no shortened or extended pulses
+// are generated. A width of zero holds the line low, and a width of a
+// whole period or more holds it high.
+func (p *PWM) SetWidth(ch int, width time.Duration) error {
+	if err := p.valid(ch); err != nil {
+		return err
+	}
+	if width < 0 {
+		return fmt.Errorf("invalid PWM width %v", width)
+	}
+	if width > p.period {
+		width = p.period
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.widths[ch] = width
+	return nil
+}
+
+// SetWidths sets the pulse widths of all of the channels, which take
+// effect together at the start of the next period.
+func (p *PWM) SetWidths(widths ...time.Duration) error {
+	if len(widths) != len(p.lines) {
+		return fmt.Errorf("got %d PWM widths, want %d", len(widths), len(p.lines))
+	}
+	for _, w := range widths {
+		if w < 0 {
+			return fmt.Errorf("invalid PWM width %v", w)
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ch, w := range widths {
+		if w > p.period {
+			w = p.period
+		}
+		p.widths[ch] = w
+	}
+	return nil
+}
+
+// SetDuty sets the duty cycle, in the range [0,1], of channel ch. See
+// SetWidth().
+func (p *PWM) SetDuty(ch int, duty float64) error {
+	if duty < 0 || duty > 1 || math.IsNaN(duty) {
+		return fmt.Errorf("invalid PWM duty cycle %v", duty)
+	}
+	return p.SetWidth(ch, time.Duration(duty*float64(p.period)))
+}
+
+// Duty returns the duty cycle of channel ch.
+func (p *PWM) Duty(ch int) float64 {
+	if p.valid(ch) != nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return float64(p.widths[ch]) / float64(p.period)
+}
+
+// Stats returns the timing statistics accumulated so far.
+func (p *PWM) Stats() PWMStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	if n := float64(s.Ticks); n != 0 {
+		mean := p.sum / n
+		s.Mean = time.Duration(mean)
+		s.StdDev = time.Duration(math.Sqrt(math.Max(0, p.sumSq/n-mean*mean)))
+	}
+	return s
+}
+
+// Close stops generating the signals at the end of the current
+// period, leaving the lines low, and returns the first error
+// encountered while driving them.
+func (p *PWM) Close() error {
+	p.cancel()
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// pwmTick holds the channel values to set at an offset into a period.
+type pwmTick struct {
+	at time.Duration
+	on map[int]bool
+}
+
+// schedule returns the ticks of a period with the given pulse widths.
+// The values of the first tick, at offset zero, are only those that
+// differ from the end of the previous period, described by high.
+func (p *PWM) schedule(widths []time.Duration, high []bool) []pwmTick {
+	ticks := []pwmTick{{on: make(map[int]bool)}}
+	falls := make(map[time.Duration]map[int]bool)
+	for ch, w := range widths {
+		on := w > 0
+		if on != high[ch] {
+			ticks[0].on[ch] = on
+		}
+		if !on || w >= p.period {
+			high[ch] = on
+			continue
+		}
+		high[ch] = false
+		if falls[w] == nil {
+			falls[w] = make(map[int]bool)
+		}
+		falls[w][ch] = false
+	}
+	for at, on := range falls {
+		ticks = append(ticks, pwmTick{at: at, on: on})
+	}
+	sort.Slice(ticks, func(i, j int) bool { return ticks[i].at < ticks[j].at })
+	return ticks
+}
+
+// commit applies the values of a tick in a single transaction.
+func (p *PWM) commit(on map[int]bool) error {
+	t, err := Hold(p.lines...)
+	if err != nil {
+		return err
+	}
+	for ch, v := range on {
+		if err := t.Set(p.lines[ch], v); err != nil {
+			t.Release()
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+// record accumulates the lateness of a tick, and whether it was late
+// enough to restart the timing of the period.
+func (p *PWM) record(late time.Duration, overrun bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Ticks++
+	if overrun {
+		p.stats.Overruns++
+	}
+	if late > p.stats.Max {
+		p.stats.Max = late
+	}
+	ns := float64(late)
+	p.sum += ns
+	p.sumSq += ns * ns
+}
+
+// run generates the signals until ctx is done.
+func (p *PWM) run(ctx context.Context) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer close(p.done)
+
+	high := make([]bool, len(p.lines))
+	widths := make([]time.Duration, len(p.lines))
+	pc := pacer{clock: p.clock}
+	pc.start()
+	// carry is the remainder of the previous period.
+	var carry time.Duration
+	var err error
+	for err == nil {
+		target := pc.next.Add(carry)
+		pc.wait(carry)
+		if ctx.Err() != nil {
+			break
+		}
+		// Pulse widths are only adopted at the start of a
+		// period.
+		if p.update != nil {
+			p.update()
+		}
+		p.mu.Lock()
+		copy(widths, p.widths)
+		p.stats.Periods++
+		p.mu.Unlock()
+
+		var prev time.Duration
+		for _, t := range p.schedule(widths, high) {
+			if len(t.on) == 0 {
+				continue
+			}
+			if t.at != prev {
+				target = pc.next.Add(t.at - prev)
+				pc.wait(t.at - prev)
+				prev = t.at
+			}
+			p.record(pc.now().Sub(target), !pc.next.Equal(target))
+			if err = p.commit(t.on); err != nil {
+				break
+			}
+		}
+		carry = p.period - prev
+	}
+	low := make(map[int]bool)
+	for ch := range p.lines {
+		low[ch] = false
+	}
+	if e := p.commit(low); err == nil {
+		err = e
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
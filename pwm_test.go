@@ -0,0 +1,161 @@
+package gpio
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// pwmClock is a virtual clock for a PWM. Once a wait would pass stop,
+// it signals reached and blocks until release is closed. The hook is
+// called from the PWM goroutine, before each wait.
+type pwmClock struct {
+	at, stop time.Time
+	hook     func(at time.Time)
+	reached  chan struct{}
+	stopped  bool
+	release  chan struct{}
+}
+
+func (c *pwmClock) now() time.Time { return c.at }
+
+func (c *pwmClock) sleepUntil(t time.Time) {
+	if c.hook != nil {
+		c.hook(c.at)
+	}
+	if t.After(c.stop) && c.reached != nil && !c.stopped {
+		c.stopped = true
+		close(c.reached)
+		<-c.release
+	}
+	if t.After(c.at) {
+		c.at = t
+	}
+}
+
+// pwmSample is a flag value and the virtual time it was set.
+type pwmSample struct {
+	at    time.Duration
+	value uint64
+}
+
+// pwmTracer records the samples of a Flag against a pwmClock.
+type pwmTracer struct {
+	c       *pwmClock
+	base    time.Time
+	samples []pwmSample
+}
+
+func (r *pwmTracer) TimedSample(when time.Time, src Named, mask, value uint64) {
+	r.samples = append(r.samples, pwmSample{at: r.c.at.Sub(r.base), value: value})
+}
+
+func TestPWM(t *testing.T) {
+	f := NewFlag()
+	var lines []Line
+	for i := 0; i < 4; i++ {
+		lines = append(lines, FlagLine(f, i))
+	}
+	p, err := newPWM(50, lines...)
+	if err != nil {
+		t.Fatalf("newPWM failed: %v", err)
+	}
+	period := p.Period()
+	if period != 20*time.Millisecond {
+		t.Fatalf("got period %v, want 20ms", period)
+	}
+	base := time.Now()
+	c := &pwmClock{
+		at:      base,
+		stop:    base.Add(5 * period),
+		reached: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	// Change the duty cycle of channel 0 part way through the third
+	// period, after its pulse.
+	c.hook = func(at time.Time) {
+		if at.Sub(base) == 2*period+period/4 {
+			p.SetDuty(0, 0.75)
+		}
+	}
+	p.clock = c
+	rec := &pwmTracer{c: c, base: base}
+	f.SetTimedTracer(rec)
+
+	p.SetDuty(0, 0.25)
+	p.SetDuty(1, 0.5)
+	p.SetDuty(2, 1)
+	p.SetDuty(3, 0)
+	if err := p.SetDuty(4, 0.5); err == nil {
+		t.Error("invalid channel accepted")
+	}
+	if err := p.SetDuty(0, 1.5); err == nil {
+		t.Error("invalid duty cycle accepted")
+	}
+	if got := p.Duty(1); got != 0.5 {
+		t.Errorf("channel 1 duty got %v, want 0.5", got)
+	}
+
+	p.start(context.Background())
+	<-c.reached
+	p.cancel()
+	close(c.release)
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	ms := time.Millisecond
+	var want []pwmSample
+	for i := 0; i < 3; i++ {
+		at := time.Duration(i) * period
+		want = append(want,
+			pwmSample{at, 7},
+			pwmSample{at + 5*ms, 6},
+			pwmSample{at + 10*ms, 4})
+	}
+	for i := 3; i < 6; i++ {
+		at := time.Duration(i) * period
+		want = append(want,
+			pwmSample{at, 7},
+			pwmSample{at + 10*ms, 5},
+			pwmSample{at + 15*ms, 4})
+	}
+	want = append(want, pwmSample{6 * period, 0})
+	if got := rec.samples[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got samples:\n%v\nwant:\n%v", got, want)
+	}
+
+	s := p.Stats()
+	if s.Periods != 6 || s.Ticks != 18 || s.Overruns != 0 || s.Max != 0 {
+		t.Errorf("unexpected stats: %v", s)
+	}
+}
+
+func TestPWMRealTime(t *testing.T) {
+	f := NewFlag()
+	p, err := NewPWM(context.Background(), 200, FlagLine(f, 0), FlagLine(f, 1))
+	if err != nil {
+		t.Fatalf("NewPWM failed: %v", err)
+	}
+	if err := p.SetWidths(time.Millisecond, 2*time.Millisecond); err != nil {
+		t.Fatalf("SetWidths failed: %v", err)
+	}
+	if err := p.SetWidths(time.Millisecond); err == nil {
+		t.Error("short list of widths accepted")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	s := p.Stats()
+	if s.Periods == 0 || s.Ticks == 0 || s.Max < s.Mean {
+		t.Errorf("unexpected stats: %v", s)
+	}
+	if got, _ := f.Get(0); got {
+		t.Error("line left high after Close")
+	}
+	if _, err := NewPWM(context.Background(), 0, FlagLine(f, 0)); err == nil {
+		t.Error("zero frequency accepted")
+	}
+}
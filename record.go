@@ -0,0 +1,194 @@
+package gpio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// recorder is the common implementation of the tracers that write
+// one record per Change.
+type recorder struct {
+	// mu protects all subsequent fields.
+	mu  sync.Mutex
+	log changeLog
+	err error
+	c   io.Closer
+
+	// emit writes a single record and flush flushes any buffered
+	// records.
+	emit  func(ch Change) error
+	flush func() error
+}
+
+// Add registers src with the tracer using module as the source name
+// in its records. Sources that are not explicitly added are given
+// default names.
+func (r *recorder) Add(src Named, module string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log.module(src, module)
+}
+
+// LabelLine names a line of src in subsequent records.
+func (r *recorder) LabelLine(src Named, index int, label string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log.label(src, index, label)
+	return nil
+}
+
+// writeLocked emits a record for each change.
+func (r *recorder) writeLocked(chs []Change) {
+	for _, ch := range chs {
+		if err := r.emit(ch); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+}
+
+// TimedSample records the line changes of a Bank or Flag sample.
+func (r *recorder) TimedSample(when time.Time, src Named, mask, value uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeLocked(r.log.sample(when, src, mask, value))
+}
+
+// TimedSampleNum records a change of a Vector value.
+func (r *recorder) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeLocked(r.log.sampleNum(when, src, index, value))
+}
+
+// Annotate records an annotation of src.
+func (r *recorder) Annotate(when time.Time, src Named, text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeLocked(r.log.annotate(when, src, text))
+}
+
+// Flush writes all buffered records and returns the first error
+// encountered while recording.
+func (r *recorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// Close flushes the records and, if the underlying io.Writer is an
+// io.Closer, closes it.
+func (r *recorder) Close() error {
+	err := r.Flush()
+	if r.c != nil {
+		if e := r.c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// recordTime is the format of timestamps in CSV and JSON records.
+const recordTime = time.RFC3339Nano
+
+// CSVTracer is a tracer that writes one CSV record per change. The
+// columns are: time,source,index,label,old,new. The old column is
+// empty for the first traced value of a line. Annotations are recorded
+// with an empty index and their text in the label column.
+type CSVTracer struct {
+	recorder
+}
+
+// NewCSVTracer returns a tracer that writes CSV records to w,
+// starting with a header record.
+func NewCSVTracer(w io.Writer) *CSVTracer {
+	cw := csv.NewWriter(w)
+	t := &CSVTracer{}
+	t.c, _ = w.(io.Closer)
+	t.emit = func(ch Change) error {
+		if ch.Annotation() {
+			return cw.Write([]string{ch.When.Format(recordTime), ch.Module, "", ch.Text, "", ""})
+		}
+		old := ""
+		if ch.Known {
+			old = fmt.Sprint(ch.Old)
+		}
+		return cw.Write([]string{
+			ch.When.Format(recordTime),
+			ch.Module,
+			fmt.Sprint(ch.Index),
+			ch.Label,
+			old,
+			fmt.Sprint(ch.New),
+		})
+	}
+	t.flush = func() error {
+		cw.Flush()
+		return cw.Error()
+	}
+	t.err = cw.Write([]string{"time", "source", "index", "label", "old", "new"})
+	return t
+}
+
+// jsonRecord is the JSON form of a Change.
+type jsonRecord struct {
+	Time   string `json:"time"`
+	Source string `json:"source"`
+	Index  int    `json:"index"`
+	Label  string `json:"label"`
+	Old    *int64 `json:"old"`
+	New    int64  `json:"new"`
+}
+
+// jsonNote is the JSON form of an annotation.
+type jsonNote struct {
+	Time   string `json:"time"`
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+// JSONTracer is a tracer that writes one JSON object per line for
+// each change. The old value is null for the first traced value of a
+// line. Annotations are written as objects with a "note" field in
+// place of the index, label and values.
+type JSONTracer struct {
+	recorder
+}
+
+// NewJSONTracer returns a tracer that writes JSON-lines records to w.
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	t := &JSONTracer{}
+	t.c, _ = w.(io.Closer)
+	t.emit = func(ch Change) error {
+		if ch.Annotation() {
+			return enc.Encode(jsonNote{
+				Time:   ch.When.Format(recordTime),
+				Source: ch.Module,
+				Note:   ch.Text,
+			})
+		}
+		rec := jsonRecord{
+			Time:   ch.When.Format(recordTime),
+			Source: ch.Module,
+			Index:  ch.Index,
+			Label:  ch.Label,
+			New:    ch.New,
+		}
+		if ch.Known {
+			old := ch.Old
+			rec.Old = &old
+		}
+		return enc.Encode(rec)
+	}
+	t.flush = bw.Flush
+	return t
+}
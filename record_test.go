@@ -0,0 +1,49 @@
+package gpio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRecordTracers(t *testing.T) {
+	cb, jb := &bytes.Buffer{}, &bytes.Buffer{}
+	ct, jt := NewCSVTracer(cb), NewJSONTracer(jb)
+	f := NewFlag()
+	ct.Add(f, "flags")
+	jt.Add(f, "flags")
+	ct.LabelLine(f, 1, "ready")
+	jt.LabelLine(f, 1, "ready")
+	f.SetTimedTracer(Tee{ct, jt})
+	f.Set(1, true)
+	f.Set(1, false)
+	f.Annotate("done")
+	if err := ct.Close(); err != nil {
+		t.Fatalf("csv close failed: %v", err)
+	}
+	if err := jt.Close(); err != nil {
+		t.Fatalf("json close failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(cb.String()), "\n")
+	if len(lines) != 4 || lines[0] != "time,source,index,label,old,new" {
+		t.Fatalf("bad csv output: %q", lines)
+	}
+	if !strings.HasSuffix(lines[1], ",flags,1,ready,,1") || !strings.HasSuffix(lines[2], ",flags,1,ready,1,0") {
+		t.Errorf("bad csv records: %q", lines[1:])
+	}
+	if !strings.HasSuffix(lines[3], ",flags,,done,,") {
+		t.Errorf("bad csv annotation: %q", lines[3])
+	}
+	lines = strings.Split(strings.TrimSpace(jb.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("bad json output: %q", lines)
+	}
+	if !strings.HasSuffix(lines[0], `"source":"flags","index":1,"label":"ready","old":null,"new":1}`) ||
+		!strings.HasSuffix(lines[1], `"source":"flags","index":1,"label":"ready","old":1,"new":0}`) {
+		t.Errorf("bad json records: %q", lines)
+	}
+	if !strings.HasSuffix(lines[2], `"source":"flags","note":"done"}`) {
+		t.Errorf("bad json annotation: %q", lines[2])
+	}
+}
@@ -0,0 +1,192 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Player replays the recorded value changes of a VCD onto Bank, Flag
+// and Vector lines, reproducing the recorded timing. Changes that
+// share a VCD timestamp are applied together in a single transaction.
+type Player struct {
+	vcd   *VCD
+	speed float64
+	loop  bool
+
+	// lines holds the line each mapped VCD variable is replayed
+	// onto, keyed by the index of the variable in vcd.Vars.
+	lines map[int]Line
+}
+
+// NewPlayer prepares to replay v. The speed factor scales the
+// playback rate, so 2 replays the changes twice as fast as they were
+// recorded. If loop is true, the replay repeats until it is canceled.
+func NewPlayer(v *VCD, speed float64, loop bool) *Player {
+	if speed <= 0 {
+		speed = 1
+	}
+	return &Player{
+		vcd:   v,
+		speed: speed,
+		loop:  loop,
+		lines: make(map[int]Line),
+	}
+}
+
+// Map replays the named VCD variable onto l. The name is matched as
+// described for (*VCD).Find().
+func (p *Player) Map(name string, l Line) error {
+	i, ok := p.vcd.Find(name)
+	if !ok {
+		return fmt.Errorf("no VCD variable %q", name)
+	}
+	p.lines[i] = l
+	return nil
+}
+
+// MapBank replays VCD wire variables onto the output lines of b. If
+// scope is not empty, only variables declared within a scope of that
+// name are considered. A variable matches an output line, g, if its
+// name is the LineLabel() of g, or the default iotracer label of g,
+// sig<g>. The number of newly mapped lines is returned.
+func (p *Player) MapBank(b *Bank, scope string) (int, error) {
+	if b == nil {
+		return 0, fmt.Errorf("no bank to map")
+	}
+	b.mu.Lock()
+	outs := b.outsMask
+	b.mu.Unlock()
+	mapped := make(map[Line]bool)
+	for _, l := range p.lines {
+		mapped[l] = true
+	}
+	n := 0
+	for _, g := range unpackMask(outs) {
+		l := BankLine(b, int(g))
+		if mapped[l] {
+			continue
+		}
+		label, offset := vcdRef(b.LineLabel(int(g))), fmt.Sprintf("sig%d", g)
+		for i, vv := range p.vcd.Vars {
+			if _, ok := p.lines[i]; ok || vv.Width != 1 || (vv.Name != label && vv.Name != offset) {
+				continue
+			}
+			if scope != "" && !inScope(vv, scope) {
+				continue
+			}
+			p.lines[i] = l
+			n++
+			break
+		}
+	}
+	return n, nil
+}
+
+// inScope indicates v is declared within a scope named scope.
+func inScope(v VCDVar, scope string) bool {
+	for _, s := range v.Scope {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until the replay time, at, of a pass that started at
+// start.
+func (p *Player) wait(ctx context.Context, start time.Time, at time.Duration) error {
+	d := time.Until(start.Add(time.Duration(float64(at) / p.speed)))
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// apply sets the lines of a group of simultaneous events.
+func (p *Player) apply(events []VCDEvent) error {
+	staged := make(map[Line]int64)
+	var lines []Line
+	for _, ev := range events {
+		l, ok := p.lines[ev.Var]
+		if !ok || !ev.Known {
+			continue
+		}
+		if _, ok := staged[l]; !ok {
+			lines = append(lines, l)
+		}
+		staged[l] = ev.Value
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	t, err := Hold(lines...)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if l.h.numeric() {
+			err = t.SetNum(l, staged[l])
+		} else {
+			err = t.Set(l, staged[l] != 0)
+		}
+		if err != nil {
+			t.Release()
+			return err
+		}
+	}
+	return t.Commit()
+}
+
+// Play replays the mapped VCD variables. It returns once the replay
+// is complete, or when ctx is canceled. A looping replay only ends
+// when ctx is canceled.
+func (p *Player) Play(ctx context.Context) error {
+	if len(p.lines) == 0 {
+		return fmt.Errorf("no VCD variables mapped for replay")
+	}
+	var events []VCDEvent
+	for _, ev := range p.vcd.Events {
+		if _, ok := p.lines[ev.Var]; ok {
+			events = append(events, ev)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+	start := time.Now()
+	for {
+		for i := 0; i < len(events); {
+			j := i + 1
+			for j < len(events) && events[j].At == events[i].At {
+				j++
+			}
+			if err := p.wait(ctx, start, events[i].At); err != nil {
+				return err
+			}
+			if err := p.apply(events[i:j]); err != nil {
+				return err
+			}
+			i = j
+		}
+		if !p.loop {
+			return nil
+		}
+		if p.vcd.End == 0 {
+			// Without any duration, repeating the replay
+			// would only spin.
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		start = start.Add(time.Duration(float64(p.vcd.End) / p.speed))
+		if err := p.wait(ctx, start, 0); err != nil {
+			return err
+		}
+	}
+}
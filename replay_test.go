@@ -0,0 +1,121 @@
+package gpio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"zappem.net/pub/io/iotracer"
+)
+
+func TestReadVCD(t *testing.T) {
+	tr := iotracer.NewTrace("test", 10)
+	tr.Module("pins")
+	tr.Label(1, "ready")
+	start := time.Now()
+	tr.SampleAt(start, 3, 0)
+	tr.SampleAt(start.Add(2*time.Millisecond), 3, 2)
+	tr.SampleAt(start.Add(5*time.Millisecond), 3, 3)
+	r, err := tr.VCD(time.Microsecond)
+	if err != nil {
+		t.Fatalf("VCD failed: %v", err)
+	}
+	v, err := ReadVCD(r)
+	if err != nil {
+		t.Fatalf("ReadVCD failed: %v", err)
+	}
+	if v.Scale != time.Microsecond || len(v.Vars) != 2 {
+		t.Fatalf("got scale=%v vars=%v", v.Scale, v.Vars)
+	}
+	i, ok := v.Find("pins.ready")
+	if !ok || v.Vars[i].Path() != "test.pins.ready" {
+		t.Fatalf("find got %d,%v in %v", i, ok, v.Vars)
+	}
+	var got []VCDEvent
+	for _, ev := range v.Events {
+		if ev.Var == i {
+			got = append(got, ev)
+		}
+	}
+	if len(got) != 2 || got[0].At != 0 || got[0].Value != 0 || got[1].At != 2*time.Millisecond || got[1].Value != 1 {
+		t.Errorf("bad ready events: %v", got)
+	}
+	if v.End != 5*time.Millisecond {
+		t.Errorf("got end=%v want 5ms", v.End)
+	}
+
+	if _, err := ReadVCD(strings.NewReader("$var wire 1 ! a $end\n")); err == nil {
+		t.Error("truncated VCD parsed without error")
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewVCDWriter(buf, "test", time.Microsecond, 0)
+	f := NewFlag()
+	w.Add(f, "flags")
+	w.LabelLine(f, 0, "clk")
+	w.LabelLine(f, 1, "data")
+	start := time.Now()
+	w.TimedSample(start, f, 3, 0)
+	w.TimedSample(start.Add(10*time.Millisecond), f, 3, 3)
+	w.TimedSample(start.Add(20*time.Millisecond), f, 3, 2)
+	// Annotation text that looks like VCD commands is escaped.
+	w.Annotate(start.Add(30*time.Millisecond), f, "end $end\n$upscope \\x")
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	v, err := ReadVCD(buf)
+	if err != nil {
+		t.Fatalf("ReadVCD failed: %v\n%s", err, buf.String())
+	}
+	if !v.Start.Equal(start) {
+		t.Errorf("VCD start got=%v want=%v", v.Start, start)
+	}
+	// The 2 declared flag bits start unknown, followed by 5 changes
+	// and the annotation.
+	if n := len(v.Events); n != 2+6 || v.Events[n-1].Text != `flags: end $end $upscope \x` {
+		t.Fatalf("bad events: %v", v.Events)
+	}
+
+	out := NewFlag()
+	rec := NewRing(0, 0)
+	out.SetTimedTracer(rec)
+	p := NewPlayer(v, 2, false)
+	if err := p.Map("clk", FlagLine(out, 3)); err != nil {
+		t.Fatalf("map clk failed: %v", err)
+	}
+	if err := p.Map("flags.data", FlagLine(out, 4)); err != nil {
+		t.Fatalf("map data failed: %v", err)
+	}
+	if err := p.Map("nothing", FlagLine(out, 5)); err == nil {
+		t.Error("mapped an unknown variable")
+	}
+	began := time.Now()
+	if err := p.Play(context.Background()); err != nil {
+		t.Fatalf("play failed: %v", err)
+	}
+	if d := time.Since(began); d < 10*time.Millisecond {
+		t.Errorf("replay at double speed took %v, want at least 10ms", d)
+	}
+	var got []int64
+	for _, ch := range rec.Changes(time.Time{}) {
+		got = append(got, int64(ch.Index), ch.New)
+	}
+	if want := []int64{3, 0, 4, 0, 3, 1, 4, 1, 3, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got (index, value) changes %v, want %v", got, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Millisecond)
+	defer cancel()
+	if err := NewPlayer(v, 4, true).Play(ctx); err == nil {
+		t.Error("unmapped replay did not fail")
+	}
+	p.loop = true
+	if err := p.Play(ctx); err != context.DeadlineExceeded {
+		t.Errorf("looping replay ended with %v", err)
+	}
+}
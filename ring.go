@@ -0,0 +1,260 @@
+package gpio
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// history holds the recent changes of a single source.
+type history struct {
+	// ring holds the retained changes in time order. The oldest
+	// is ring[head] and n entries, wrapping around the end of
+	// ring, are in use.
+	ring    []Change
+	head, n int
+
+	// base holds, for each index, the most recent change that has
+	// been discarded from ring. It records the value of the index
+	// at the start of the retained history.
+	base map[int]Change
+}
+
+// at returns the i'th oldest retained change.
+func (h *history) at(i int) Change {
+	return h.ring[(h.head+i)%len(h.ring)]
+}
+
+// push appends a change to the retained history. The backing array
+// only grows if it is full, which only happens when there is no
+// count limit.
+func (h *history) push(ch Change) {
+	if h.n == len(h.ring) {
+		size := 2 * len(h.ring)
+		if size == 0 {
+			size = 16
+		}
+		ring := make([]Change, size)
+		for i := 0; i < h.n; i++ {
+			ring[i] = h.at(i)
+		}
+		h.ring, h.head = ring, 0
+	}
+	h.ring[(h.head+h.n)%len(h.ring)] = ch
+	h.n++
+}
+
+// pop discards the oldest retained change, recording it in base.
+func (h *history) pop() {
+	old := h.ring[h.head]
+	h.ring[h.head] = Change{}
+	h.head = (h.head + 1) % len(h.ring)
+	h.n--
+	if !old.Annotation() {
+		h.base[old.Index] = old
+	}
+}
+
+// retained returns a copy of the retained changes in time order.
+func (h *history) retained() []Change {
+	chs := make([]Change, h.n)
+	for i := range chs {
+		chs[i] = h.at(i)
+	}
+	return chs
+}
+
+// Ring is a tracer that keeps the recent history of each of its
+// sources in memory, and can answer queries about it. Per source, it
+// retains up to a count of changes, and changes no older than a
+// duration relative to the most recent change.
+type Ring struct {
+	count int
+	keep  time.Duration
+
+	// mu protects all subsequent fields.
+	mu   sync.Mutex
+	log  changeLog
+	hist map[Named]*history
+}
+
+// NewRing returns a tracer that retains up to count changes per
+// source, and if keep is non-zero, only those changes that occurred
+// within keep of the latest one. A count of zero means that only keep
+// limits the history.
+func NewRing(count int, keep time.Duration) *Ring {
+	return &Ring{
+		count: count,
+		keep:  keep,
+		hist:  make(map[Named]*history),
+	}
+}
+
+// Add registers src with the tracer using module as its name.
+func (r *Ring) Add(src Named, module string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log.module(src, module)
+}
+
+// LabelLine names a line of src in subsequently recorded changes.
+func (r *Ring) LabelLine(src Named, index int, label string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log.label(src, index, label)
+	return nil
+}
+
+// recordLocked appends changes to the history of their source,
+// discarding changes that no longer fit.
+func (r *Ring) recordLocked(chs []Change) {
+	for _, ch := range chs {
+		h, ok := r.hist[ch.Source]
+		if !ok {
+			h = &history{base: make(map[int]Change)}
+			if r.count != 0 {
+				h.ring = make([]Change, r.count)
+			}
+			r.hist[ch.Source] = h
+		}
+		if r.count != 0 && h.n == r.count {
+			h.pop()
+		}
+		h.push(ch)
+		for r.keep != 0 && ch.When.Sub(h.at(0).When) > r.keep {
+			h.pop()
+		}
+	}
+}
+
+// record appends previously computed changes to the history,
+// adopting their module names and labels.
+func (r *Ring) record(chs []Change) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ch := range chs {
+		r.log.module(ch.Source, ch.Module)
+		if !ch.Annotation() {
+			r.log.label(ch.Source, ch.Index, ch.Label)
+		}
+	}
+	r.recordLocked(chs)
+}
+
+// TimedSample records the line changes of a Bank or Flag sample.
+func (r *Ring) TimedSample(when time.Time, src Named, mask, value uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordLocked(r.log.sample(when, src, mask, value))
+}
+
+// TimedSampleNum records a change of a Vector value.
+func (r *Ring) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordLocked(r.log.sampleNum(when, src, index, value))
+}
+
+// Annotate records an annotation of src in its history. Annotations
+// are retained like changes, and are returned by Changes().
+func (r *Ring) Annotate(when time.Time, src Named, text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recordLocked(r.log.annotate(when, src, text))
+}
+
+// ValueAt returns the value of the indexed line of src at time when.
+// An error is returned if the value at that time is not known from
+// the retained history.
+func (r *Ring) ValueAt(src Named, index int, when time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hist[src]
+	if !ok {
+		return 0, fmt.Errorf("no history for source")
+	}
+	for i := h.n - 1; i >= 0; i-- {
+		if ch := h.at(i); ch.Index == index && !ch.When.After(when) {
+			return ch.New, nil
+		}
+	}
+	if ch, ok := h.base[index]; ok && !ch.When.After(when) {
+		return ch.New, nil
+	}
+	return 0, fmt.Errorf("value of %d at %v is not known", index, when)
+}
+
+// Transitions returns the retained changes of the indexed line of
+// src that occurred after since.
+func (r *Ring) Transitions(src Named, index int, since time.Time) []Change {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hist[src]
+	if !ok {
+		return nil
+	}
+	var chs []Change
+	for i := 0; i < h.n; i++ {
+		if ch := h.at(i); ch.Index == index && ch.When.After(since) {
+			chs = append(chs, ch)
+		}
+	}
+	return chs
+}
+
+// Changes returns all of the retained changes, of all sources, that
+// occurred after since in time order.
+func (r *Ring) Changes(since time.Time) []Change {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var chs []Change
+	for _, t := range r.log.order {
+		if h, ok := r.hist[t.src]; ok {
+			for i := 0; i < h.n; i++ {
+				if ch := h.at(i); ch.When.After(since) {
+					chs = append(chs, ch)
+				}
+			}
+		}
+	}
+	sort.SliceStable(chs, func(i, j int) bool { return chs[i].When.Before(chs[j].When) })
+	return chs
+}
+
+// snapshot returns the retained history in time order. Each index
+// starts with its value at the beginning of the retained history, if
+// that is known.
+func (r *Ring) snapshot() []Change {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var chs []Change
+	for _, t := range r.log.order {
+		h, ok := r.hist[t.src]
+		if !ok {
+			continue
+		}
+		var indices []int
+		for index := range h.base {
+			indices = append(indices, index)
+		}
+		sort.Ints(indices)
+		for _, index := range indices {
+			chs = append(chs, h.base[index])
+		}
+		chs = append(chs, h.retained()...)
+	}
+	sort.SliceStable(chs, func(i, j int) bool { return chs[i].When.Before(chs[j].When) })
+	return chs
+}
+
+// VCD writes the retained history as a Value Change Dump to w. The
+// app names the top level VCD scope and tScale is the duration of one
+// VCD time unit.
+func (r *Ring) VCD(w io.Writer, app string, tScale time.Duration) error {
+	vw := NewVCDWriter(w, app, tScale, 0)
+	vw.c = nil
+	vw.record(r.snapshot())
+	return vw.Flush()
+}
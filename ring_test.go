@@ -0,0 +1,83 @@
+package gpio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(3, 0)
+	f := NewFlag()
+	r.Add(f, "flags")
+	start := time.Now()
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+	for i, v := range []uint64{1, 3, 2, 0, 1} {
+		r.TimedSample(at(10*i), f, 3, v)
+	}
+	// Bit 0 changes at 0,20,40 ms and bit 1 changes at 0,10,30 ms.
+	if got := r.Transitions(f, 0, time.Time{}); len(got) != 2 || got[0].New != 0 || got[1].New != 1 {
+		t.Errorf("bad transitions of bit 0: %v", got)
+	}
+	for _, test := range []struct {
+		index int
+		ms    int
+		want  int64
+		err   bool
+	}{
+		{index: 1, ms: 5, err: true},
+		{index: 0, ms: 5, want: 1},
+		{index: 1, ms: 15, want: 1},
+		{index: 0, ms: 25, want: 0},
+		{index: 1, ms: 35, want: 0},
+		{index: 0, ms: 45, want: 1},
+	} {
+		v, err := r.ValueAt(f, test.index, at(test.ms))
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for bit %d at %dms, got %d", test.index, test.ms, v)
+			}
+			continue
+		}
+		if err != nil || v != test.want {
+			t.Errorf("bit %d at %dms: got=%d,%v want=%d", test.index, test.ms, v, err, test.want)
+		}
+	}
+
+	k := NewRing(0, 15*time.Millisecond)
+	for i, v := range []uint64{1, 0, 1, 0} {
+		k.TimedSample(at(10*i), f, 1, v)
+	}
+	if got := k.Changes(time.Time{}); len(got) != 2 {
+		t.Errorf("duration limited ring retained %d changes, want 2", len(got))
+	}
+
+	u := NewRing(0, 0)
+	for i := 0; i < 40; i++ {
+		u.TimedSample(at(i), f, 1, uint64(i&1))
+	}
+	if got := u.Changes(time.Time{}); len(got) != 40 || !got[0].When.Equal(at(0)) || !got[39].When.Equal(at(39)) {
+		t.Errorf("unlimited ring retained %d changes, want 40 in order", len(got))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.VCD(buf, "ring", time.Millisecond); err != nil {
+		t.Fatalf("failed to dump VCD: %v", err)
+	}
+	dump := buf.String()
+	for _, want := range []string{
+		"$scope module flags $end",
+		"$var wire 1 \" sig1 $end",
+		"#10\n1\"\n",
+		"#20\n0!\n",
+		"#30\n0\"\n",
+		"#40\n1!\n",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("VCD dump is missing %q:\n%s", want, dump)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package gpio
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ServoHz is the frequency of the pulses sent to hobby servos.
+const ServoHz = 50
+
+// ServoConfig holds the calibration of a servo. The zero value
+// describes a typical servo: 1ms to 2ms pulses for angles of 0 to
+// 180 degrees, with no limits beyond those and no speed limit.
+type ServoConfig struct {
+	// MinPulse and MaxPulse are the pulse widths that position the
+	// servo at MinAngle and MaxAngle respectively. Reversing them
+	// reverses the direction of the servo.
+	MinPulse, MaxPulse time.Duration
+	MinAngle, MaxAngle float64
+
+	// Lower and Upper limit the angles the servo is moved to, for
+	// mechanisms that cannot use its full range. When both are
+	// zero, they default to MinAngle and MaxAngle.
+	Lower, Upper float64
+
+	// Speed, if non-zero, limits the speed of moves in degrees per
+	// second.
+	Speed float64
+}
+
+// defaults fills in the unspecified values of c.
+func (c ServoConfig) defaults() ServoConfig {
+	if c.MinPulse == 0 && c.MaxPulse == 0 {
+		c.MinPulse, c.MaxPulse = time.Millisecond, 2*time.Millisecond
+	}
+	if c.MinAngle == 0 && c.MaxAngle == 0 {
+		c.MaxAngle = 180
+	}
+	if c.Lower == 0 && c.Upper == 0 {
+		c.Lower, c.Upper = c.MinAngle, c.MaxAngle
+	}
+	return c
+}
+
+// pulse returns the pulse width that positions a servo at angle.
+func (c ServoConfig) pulse(angle float64) time.Duration {
+	f := (angle - c.MinAngle) / (c.MaxAngle - c.MinAngle)
+	return c.MinPulse + time.Duration(math.Round(f*float64(c.MaxPulse-c.MinPulse)))
+}
+
+// Servos drives a set of hobby servos, one per output line, from a
+// shared 50Hz PWM. The pulses of all of the servos start together and
+// every position update is applied at the start of a period, so the
+// lines of a Bank are set with one kernel call per edge time however
+// many servos share it.
+type Servos struct {
+	pwm *PWM
+
+	// mu protects servos and the state of each Servo.
+	mu     sync.Mutex
+	servos []*Servo
+}
+
+// Servo is one of the servos driven by Servos.
+type Servo struct {
+	s   *Servos
+	ch  int
+	cfg ServoConfig
+
+	// on indicates a pulse is being generated for angle. When
+	// moving, angle steps towards target each period.
+	on            bool
+	angle, target float64
+}
+
+// NewServos starts driving servos on the output lines, which are held
+// low until each servo is given a position. The servos are driven
+// until ctx is done or Close() is called.
+func NewServos(ctx context.Context, lines ...Line) (*Servos, error) {
+	s, err := newServos(lines...)
+	if err != nil {
+		return nil, err
+	}
+	s.pwm.start(ctx)
+	return s, nil
+}
+
+// newServos prepares Servos without starting them.
+func newServos(lines ...Line) (*Servos, error) {
+	p, err := newPWM(ServoHz, lines...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Servos{pwm: p}
+	for ch := range lines {
+		s.servos = append(s.servos, &Servo{s: s, ch: ch, cfg: ServoConfig{}.defaults()})
+	}
+	p.update = s.update
+	return s, nil
+}
+
+// Servo returns the servo driven by the line of index ch in the list
+// passed to NewServos, or nil if there is no such servo.
+func (s *Servos) Servo(ch int) *Servo {
+	if ch < 0 || ch >= len(s.servos) {
+		return nil
+	}
+	return s.servos[ch]
+}
+
+// Stats returns the timing statistics of the underlying PWM.
+func (s *Servos) Stats() PWMStats {
+	return s.pwm.Stats()
+}
+
+// Close stops the pulses to all of the servos, leaving the lines low.
+func (s *Servos) Close() error {
+	return s.pwm.Close()
+}
+
+// update advances the moving servos by one period and sets the pulse
+// widths of all of them together.
+func (s *Servos) update() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dt := s.pwm.Period().Seconds()
+	widths := make([]time.Duration, len(s.servos))
+	for ch, v := range s.servos {
+		if !v.on {
+			continue
+		}
+		if d := v.target - v.angle; v.cfg.Speed == 0 || math.Abs(d) <= v.cfg.Speed*dt {
+			v.angle = v.target
+		} else {
+			v.angle += math.Copysign(v.cfg.Speed*dt, d)
+		}
+		widths[ch] = v.cfg.pulse(v.angle)
+	}
+	s.pwm.SetWidths(widths...)
+}
+
+// Configure sets the calibration of the servo. The servo is not moved
+// until its next Set().
+func (v *Servo) Configure(cfg ServoConfig) error {
+	cfg = cfg.defaults()
+	period := v.s.pwm.Period()
+	for _, p := range []time.Duration{cfg.MinPulse, cfg.MaxPulse} {
+		if p <= 0 || p >= period {
+			return fmt.Errorf("invalid servo pulse %v, want (0,%v)", p, period)
+		}
+	}
+	if !(cfg.MinAngle < cfg.MaxAngle) {
+		return fmt.Errorf("invalid servo angle range [%v,%v]", cfg.MinAngle, cfg.MaxAngle)
+	}
+	if !(cfg.MinAngle <= cfg.Lower && cfg.Lower <= cfg.Upper && cfg.Upper <= cfg.MaxAngle) {
+		return fmt.Errorf("invalid servo limits [%v,%v] for range [%v,%v]", cfg.Lower, cfg.Upper, cfg.MinAngle, cfg.MaxAngle)
+	}
+	if cfg.Speed < 0 || math.IsNaN(cfg.Speed) {
+		return fmt.Errorf("invalid servo speed %v", cfg.Speed)
+	}
+	v.s.mu.Lock()
+	defer v.s.mu.Unlock()
+	v.cfg = cfg
+	return nil
+}
+
+// Set moves the servo to angle, which is clamped to the limits of its
+// configuration. The move is limited to the configured speed, except
+// for the first Set() (or the first after Off()), which positions the
+// servo directly since its starting angle is unknown.
+func (v *Servo) Set(angle float64) error {
+	if math.IsNaN(angle) {
+		return fmt.Errorf("invalid servo angle %v", angle)
+	}
+	v.s.mu.Lock()
+	defer v.s.mu.Unlock()
+	angle = math.Max(v.cfg.Lower, math.Min(v.cfg.Upper, angle))
+	v.target = angle
+	if !v.on {
+		v.on, v.angle = true, angle
+	}
+	return nil
+}
+
+// Off stops the pulses to the servo, which lets most servos relax.
+func (v *Servo) Off() {
+	v.s.mu.Lock()
+	defer v.s.mu.Unlock()
+	v.on = false
+}
+
+// Angle returns the angle the servo is currently being driven to, and
+// whether it is being driven at all.
+func (v *Servo) Angle() (float64, bool) {
+	v.s.mu.Lock()
+	defer v.s.mu.Unlock()
+	return v.angle, v.on
+}
+
+// Moving indicates the servo has not yet reached the angle of the
+// last Set().
+func (v *Servo) Moving() bool {
+	v.s.mu.Lock()
+	defer v.s.mu.Unlock()
+	return v.on && v.angle != v.target
+}
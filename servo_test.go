@@ -0,0 +1,112 @@
+package gpio
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// pwmWidths returns the pulse widths of channel ch in each of the
+// first n periods of the recorded samples.
+func pwmWidths(samples []pwmSample, period time.Duration, ch, n int) []time.Duration {
+	widths := make([]time.Duration, n)
+	var rose time.Duration
+	high := false
+	for _, s := range samples {
+		on := s.value>>ch&1 != 0
+		switch {
+		case on && !high:
+			rose = s.at
+		case !on && high:
+			if k := int(rose / period); k < n {
+				widths[k] = s.at - rose
+			}
+		}
+		high = on
+	}
+	return widths
+}
+
+func TestServos(t *testing.T) {
+	f := NewFlag()
+	s, err := newServos(FlagLine(f, 0), FlagLine(f, 1), FlagLine(f, 2))
+	if err != nil {
+		t.Fatalf("newServos failed: %v", err)
+	}
+	base := time.Now()
+	const n = 60
+	period := s.pwm.Period()
+	c := &pwmClock{
+		at:      base,
+		stop:    base.Add((n - 1) * period),
+		reached: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	s.pwm.clock = c
+	rec := &pwmTracer{c: c, base: base}
+	f.SetTimedTracer(rec)
+
+	if s.Servo(3) != nil {
+		t.Error("got a servo for a missing line")
+	}
+	s0, s1 := s.Servo(0), s.Servo(1)
+	if err := s1.Configure(ServoConfig{MinPulse: 500 * time.Microsecond, MaxPulse: 25 * time.Millisecond}); err == nil {
+		t.Error("pulse longer than the period accepted")
+	}
+	if err := s1.Configure(ServoConfig{Lower: -10, Upper: 90}); err == nil {
+		t.Error("limits outside the angle range accepted")
+	}
+	if err := s1.Configure(ServoConfig{
+		MinPulse: 500 * time.Microsecond,
+		MaxPulse: 2500 * time.Microsecond,
+		Lower:    10,
+		Upper:    170,
+		Speed:    90,
+	}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	s0.Set(90)
+	s1.Set(0)
+	s1.Set(100)
+	if !s1.Moving() {
+		t.Error("servo 1 is not moving")
+	}
+
+	s.pwm.start(context.Background())
+	<-c.reached
+	s.pwm.cancel()
+	close(c.release)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Every pulse starts at the start of a period, with both lines
+	// rising in one update.
+	for _, r := range rec.samples[1:] {
+		if r.at%period == 0 && r.value != 0 && r.value != 3 {
+			t.Errorf("at %v got lines %b, want 11", r.at, r.value)
+		}
+	}
+	for k, w := range pwmWidths(rec.samples, period, 0, n) {
+		if w != 1500*time.Microsecond {
+			t.Errorf("servo 0 period %d pulse got %v, want 1.5ms", k, w)
+		}
+	}
+	// Servo 1 starts at its lower limit, 10 degrees, and moves by
+	// 1.8 degrees (20us) per period to 100 degrees (1.611ms).
+	want := 611111 * time.Nanosecond
+	for k, w := range pwmWidths(rec.samples, period, 1, n) {
+		if want < 1611111*time.Nanosecond {
+			want += 20 * time.Microsecond
+		}
+		if d := w - want; d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("servo 1 period %d pulse got %v, want %v", k, w, want)
+		}
+	}
+	if angle, on := s1.Angle(); angle != 100 || !on || s1.Moving() {
+		t.Errorf("servo 1 got angle %v (on=%v, moving=%v), want 100", angle, on, s1.Moving())
+	}
+	if _, on := s.Servo(2).Angle(); on {
+		t.Error("servo 2 driven without being set")
+	}
+}
@@ -0,0 +1,107 @@
+package gpio
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Level is the value of a digital signal from time At onwards.
+type Level struct {
+	At time.Duration
+	On bool
+}
+
+// Signal holds the successive levels of a single digital line in time
+// order. Times are relative to the origin of the trace that the
+// signal was extracted from. Before the first Level, the value of
+// the line is not known.
+type Signal []Level
+
+// At returns the value of the signal at time t, and whether that
+// value is known.
+func (s Signal) At(t time.Duration) (on, known bool) {
+	i := sort.Search(len(s), func(i int) bool { return s[i].At > t })
+	if i == 0 {
+		return false, false
+	}
+	return s[i-1].On, true
+}
+
+// add appends a level, dropping levels that do not change the value.
+func (s Signal) add(at time.Duration, on bool) Signal {
+	if n := len(s); n != 0 && s[n-1].On == on {
+		return s
+	}
+	return append(s, Level{At: at, On: on})
+}
+
+// Signal extracts the levels of the named one bit variable of the
+// VCD. The name is matched as described for (*VCD).Find().
+func (v *VCD) Signal(name string) (Signal, error) {
+	i, ok := v.Find(name)
+	if !ok {
+		return nil, fmt.Errorf("no VCD variable %q", name)
+	}
+	if v.Vars[i].Width != 1 {
+		return nil, fmt.Errorf("VCD variable %q is %d bits wide", name, v.Vars[i].Width)
+	}
+	var s Signal
+	for _, ev := range v.Events {
+		if ev.Var == i && ev.Known {
+			s = s.add(ev.At, ev.Value != 0)
+		}
+	}
+	return s, nil
+}
+
+// SignalOf extracts the levels of the indexed line of src from
+// changes, such as those returned by (*Ring).Changes() or
+// (*Capture).Changes(). Times are made relative to origin.
+func SignalOf(chs []Change, src Named, index int, origin time.Time) Signal {
+	var s Signal
+	for _, ch := range chs {
+		if ch.Source == src && ch.Index == index {
+			s = s.add(ch.When.Sub(origin), ch.New != 0)
+		}
+	}
+	return s
+}
+
+// pulse is an interval over which a signal holds a single value.
+type pulse struct {
+	start, end time.Duration
+	on         bool
+}
+
+// pulses returns the intervals of the signal with the value on that
+// are bounded by known transitions.
+func (s Signal) pulses(on bool) []pulse {
+	var ps []pulse
+	for i := 1; i+1 < len(s); i++ {
+		if s[i].On == on {
+			ps = append(ps, pulse{start: s[i].At, end: s[i+1].At, on: on})
+		}
+	}
+	return ps
+}
+
+// edge is a transition of one of a set of signals.
+type edge struct {
+	at     time.Duration
+	signal int
+	on     bool
+}
+
+// edges merges the transitions of several signals in time order. The
+// initial level of each signal is not a transition.
+func edges(signals ...Signal) []edge {
+	var es []edge
+	for j, s := range signals {
+		for i := 1; i < len(s); i++ {
+			es = append(es, edge{at: s[i].At, signal: j, on: s[i].On})
+		}
+	}
+	sort.SliceStable(es, func(i, j int) bool { return es[i].at < es[j].at })
+	return es
+}
@@ -0,0 +1,175 @@
+package gpio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SPI is a bit-banged SPI master that drives the lines of a Bank, or
+// any other IO[bool], such as a Flag standing in for a simulated
+// device. Since it uses the ordinary Set() and Get() methods, its
+// activity is recorded by the tracer of the Bank.
+type SPI struct {
+	io                   IO[bool]
+	sclk, mosi, miso, cs int
+	cfg                  SPIConfig
+	half                 time.Duration
+
+	// mu serializes transfers.
+	mu sync.Mutex
+}
+
+// NewSPI returns an SPI master using lines sclk and mosi for output,
+// and miso for input, of io. The cs line is an optional active low
+// chip select, asserted for the duration of each transfer, and either
+// miso or cs can be -1 to indicate they are not used. The clock runs
+// at up to hz, or as fast as the lines can be toggled if hz is zero.
+// The sclk, mosi and cs lines are set to their idle state.
+func NewSPI(io IO[bool], sclk, mosi, miso, cs int, cfg SPIConfig, hz int) (*SPI, error) {
+	if cfg.Mode < 0 || cfg.Mode > 3 {
+		return nil, fmt.Errorf("invalid SPI mode %d", cfg.Mode)
+	}
+	if cfg.Bits == 0 {
+		cfg.Bits = 8
+	}
+	if cfg.Bits < 0 || cfg.Bits > 64 {
+		return nil, fmt.Errorf("invalid SPI word size %d", cfg.Bits)
+	}
+	s := &SPI{
+		io:   io,
+		sclk: sclk,
+		mosi: mosi,
+		miso: miso,
+		cs:   cs,
+		cfg:  cfg,
+	}
+	if hz > 0 {
+		s.half = time.Second / time.Duration(2*hz)
+	}
+	if err := io.Set(sclk, s.cpol()); err != nil {
+		return nil, err
+	}
+	if cs >= 0 {
+		if err := io.Set(cs, true); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// cpol returns the idle level of the clock.
+func (s *SPI) cpol() bool {
+	return s.cfg.Mode&2 != 0
+}
+
+// WordBytes returns the number of bytes used to hold each word in the
+// buffers of Tx(). Multi-byte words are held most significant byte
+// first.
+func (s *SPI) WordBytes() int {
+	return (s.cfg.Bits + 7) / 8
+}
+
+// bit exchanges a single bit, returning the bit read from miso.
+func (s *SPI) bit(p *pacer, out bool) (bool, error) {
+	idle := s.cpol()
+	var in bool
+	var err error
+	if s.cfg.Mode&1 == 0 {
+		// CPHA=0: data is set up before the leading edge and
+		// sampled on it.
+		if err = s.io.Set(s.mosi, out); err != nil {
+			return false, err
+		}
+		p.wait(s.half)
+		if err = s.io.Set(s.sclk, !idle); err != nil {
+			return false, err
+		}
+		if s.miso >= 0 {
+			if in, err = s.io.Get(s.miso); err != nil {
+				return false, err
+			}
+		}
+		p.wait(s.half)
+		return in, s.io.Set(s.sclk, idle)
+	}
+	// CPHA=1: data is set up on the leading edge and sampled on
+	// the trailing edge.
+	if err = s.io.Set(s.sclk, !idle); err != nil {
+		return false, err
+	}
+	if err = s.io.Set(s.mosi, out); err != nil {
+		return false, err
+	}
+	p.wait(s.half)
+	if err = s.io.Set(s.sclk, idle); err != nil {
+		return false, err
+	}
+	if s.miso >= 0 {
+		if in, err = s.io.Get(s.miso); err != nil {
+			return false, err
+		}
+	}
+	p.wait(s.half)
+	return in, nil
+}
+
+// Tx performs a full-duplex transfer, clocking out the words of w
+// while reading the same number of words into r. Either buffer may be
+// nil, in which case zeros are written or the words read are
+// discarded. Otherwise, both must hold the same whole number of
+// words, see WordBytes().
+func (s *SPI) Tx(w, r []byte) error {
+	n := len(w)
+	if w == nil {
+		n = len(r)
+	} else if r != nil && len(r) != n {
+		return fmt.Errorf("SPI write of %d bytes, but read of %d", len(w), len(r))
+	}
+	wb := s.WordBytes()
+	if n%wb != 0 {
+		return fmt.Errorf("SPI transfer of %d bytes is not a whole number of %d byte words", n, wb)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var p pacer
+	p.start()
+	if s.cs >= 0 {
+		if err := s.io.Set(s.cs, false); err != nil {
+			return err
+		}
+		p.wait(s.half)
+	}
+	for i := 0; i < n; i += wb {
+		var word, got uint64
+		for j := 0; j < wb; j++ {
+			word <<= 8
+			if w != nil {
+				word |= uint64(w[i+j])
+			}
+		}
+		for k := 0; k < s.cfg.Bits; k++ {
+			pos := k
+			if !s.cfg.LSBFirst {
+				pos = s.cfg.Bits - 1 - k
+			}
+			in, err := s.bit(&p, word>>pos&1 != 0)
+			if err != nil {
+				return err
+			}
+			if in {
+				got |= 1 << pos
+			}
+		}
+		for j := wb - 1; r != nil && j >= 0; j-- {
+			r[i+j] = byte(got)
+			got >>= 8
+		}
+	}
+	if s.cs >= 0 {
+		p.wait(s.half)
+		return s.io.Set(s.cs, true)
+	}
+	return nil
+}
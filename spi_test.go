@@ -0,0 +1,68 @@
+package gpio
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSPI(t *testing.T) {
+	for _, cfg := range []SPIConfig{
+		{Mode: 0},
+		{Mode: 1, LSBFirst: true},
+		{Mode: 2},
+		{Mode: 3, Bits: 12},
+	} {
+		f := NewFlag()
+		r := NewRing(0, 0)
+		f.SetTimedTracer(r)
+		start := time.Now()
+		// MISO and MOSI share line 1, so the data is looped back.
+		s, err := NewSPI(f, 0, 1, 1, 2, cfg, 100000)
+		if err != nil {
+			t.Fatalf("NewSPI(%+v) failed: %v", cfg, err)
+		}
+		w := []byte{0xa5, 0x3c, 0x0f, 0x81}
+		got := make([]byte, len(w))
+		if err := s.Tx(w, got); err != nil {
+			t.Fatalf("%+v: Tx failed: %v", cfg, err)
+		}
+		want := append([]byte(nil), w...)
+		if cfg.Bits == 12 {
+			want[0] &= 0x0f
+			want[2] &= 0x0f
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%+v: read %x, want %x", cfg, got, want)
+		}
+
+		chs := r.Changes(time.Time{})
+		frames := DecodeSPI(SignalOf(chs, f, 0, start), SignalOf(chs, f, 1, start), nil, SignalOf(chs, f, 2, start), cfg)
+		var words []string
+		for _, fr := range frames {
+			words = append(words, fmt.Sprintf("%x", fr.Value))
+		}
+		wantWords := "[a5 3c f 81]"
+		if cfg.Bits == 12 {
+			wantWords = "[53c f81]"
+		}
+		if fmt.Sprint(words) != wantWords {
+			t.Errorf("%+v: decoded %v, want %s", cfg, words, wantWords)
+		}
+	}
+
+	s, err := NewSPI(NewFlag(), 0, 1, -1, -1, SPIConfig{Bits: 16}, 0)
+	if err != nil {
+		t.Fatalf("NewSPI failed: %v", err)
+	}
+	if err := s.Tx([]byte{1, 2, 3}, nil); err == nil {
+		t.Error("partial word transfer succeeded")
+	}
+	if err := s.Tx([]byte{1, 2}, make([]byte, 4)); err == nil {
+		t.Error("mismatched buffer transfer succeeded")
+	}
+	if _, err := NewSPI(NewFlag(), 0, 1, 2, 3, SPIConfig{Mode: 4}, 0); err == nil {
+		t.Error("invalid mode accepted")
+	}
+}
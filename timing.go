@@ -0,0 +1,406 @@
+package gpio
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Slope selects the transitions of a signal that a timing constraint
+// refers to.
+type Slope int
+
+// These are the supported slopes.
+const (
+	SlopeRising Slope = iota
+	SlopeFalling
+	SlopeAny
+)
+
+// matches indicates a transition to the level on has the slope.
+func (s Slope) matches(on bool) bool {
+	return s == SlopeAny || on == (s == SlopeRising)
+}
+
+// String names the slope.
+func (s Slope) String() string {
+	switch s {
+	case SlopeRising:
+		return "rising"
+	case SlopeFalling:
+		return "falling"
+	}
+	return "any"
+}
+
+// These are the kinds of Constraint.
+const (
+	constraintSetupHold = iota
+	constraintMinPulse
+	constraintMaxLatency
+)
+
+// Constraint is a timing requirement between signals. Signals are
+// identified by name: for a VCD, as matched by (*VCD).Find(), and for
+// live checking, by the name given to Watch() or by the label the
+// traced source provides for the line.
+type Constraint struct {
+	kind       int
+	a, b       string
+	slopeA     Slope
+	slopeB     Slope
+	on         bool
+	d1, d2     time.Duration
+	descriptor string
+}
+
+// String describes the constraint.
+func (c Constraint) String() string {
+	return c.descriptor
+}
+
+// SetupHold requires that data is stable for at least setup before,
+// and hold after, each clock transition with the given slope.
+func SetupHold(data, clock string, edge Slope, setup, hold time.Duration) Constraint {
+	return Constraint{
+		kind:       constraintSetupHold,
+		a:          data,
+		b:          clock,
+		slopeB:     edge,
+		d1:         setup,
+		d2:         hold,
+		descriptor: fmt.Sprintf("setup/hold %s to %s %s edge", data, clock, edge),
+	}
+}
+
+// MinPulse requires that each pulse of signal at the level on lasts at
+// least min.
+func MinPulse(signal string, on bool, min time.Duration) Constraint {
+	level := "low"
+	if on {
+		level = "high"
+	}
+	return Constraint{
+		kind:       constraintMinPulse,
+		a:          signal,
+		on:         on,
+		d1:         min,
+		descriptor: fmt.Sprintf("minimum %s pulse of %s", level, signal),
+	}
+}
+
+// MaxLatency requires that each input transition with the inEdge
+// slope is followed within max by an output transition with the
+// outEdge slope.
+func MaxLatency(input string, inEdge Slope, output string, outEdge Slope, max time.Duration) Constraint {
+	return Constraint{
+		kind:       constraintMaxLatency,
+		a:          input,
+		slopeA:     inEdge,
+		b:          output,
+		slopeB:     outEdge,
+		d1:         max,
+		descriptor: fmt.Sprintf("latency of %s %s edge to %s %s edge", input, inEdge, output, outEdge),
+	}
+}
+
+// Violation reports a failure to meet a Constraint.
+type Violation struct {
+	// Constraint describes the failed constraint.
+	Constraint string
+
+	// At is the time of the violation, relative to the origin of
+	// the checked signals.
+	At time.Duration
+
+	// Detail describes the violation.
+	Detail string
+}
+
+// String summarizes the violation on one line.
+func (v Violation) String() string {
+	return fmt.Sprintf("%12v %s: %s", v.At, v.Constraint, v.Detail)
+}
+
+// level holds the most recent state of a checked signal.
+type level struct {
+	known, on bool
+	// changed indicates at holds the time of a transition, and
+	// not just the time of the initial level.
+	changed bool
+	at      time.Duration
+}
+
+// checkState evaluates constraints over a time ordered sequence of
+// signal transitions.
+type checkState struct {
+	cs     []Constraint
+	levels map[string]*level
+
+	// clocks holds the time of the latest matching clock edge of
+	// each setup/hold constraint, and pending the unanswered input
+	// edges of each latency constraint.
+	clocks  map[int]time.Duration
+	pending map[int][]time.Duration
+
+	report func(Violation)
+}
+
+// newCheckState prepares to evaluate constraints cs, reporting each
+// violation to report.
+func newCheckState(cs []Constraint, report func(Violation)) *checkState {
+	return &checkState{
+		cs:      cs,
+		levels:  make(map[string]*level),
+		clocks:  make(map[int]time.Duration),
+		pending: make(map[int][]time.Duration),
+		report:  report,
+	}
+}
+
+// violate reports a violation of constraint i.
+func (s *checkState) violate(i int, at time.Duration, format string, args ...interface{}) {
+	s.report(Violation{Constraint: s.cs[i].descriptor, At: at, Detail: fmt.Sprintf(format, args...)})
+}
+
+// expire reports the latency constraint violations of input edges
+// that have not been answered by time now.
+func (s *checkState) expire(now time.Duration) {
+	for i, c := range s.cs {
+		if c.kind != constraintMaxLatency {
+			continue
+		}
+		ps := s.pending[i]
+		n := 0
+		for n < len(ps) && now-ps[n] > c.d1 {
+			s.violate(i, ps[n], "no response within %v", c.d1)
+			n++
+		}
+		s.pending[i] = ps[n:]
+	}
+}
+
+// feed evaluates a new level of the named signal at time at.
+func (s *checkState) feed(name string, at time.Duration, on bool) {
+	l, ok := s.levels[name]
+	if !ok {
+		l = &level{}
+		s.levels[name] = l
+	}
+	if l.known && l.on == on {
+		return
+	}
+	s.expire(at)
+	prev := *l
+	*l = level{known: true, on: on, changed: prev.known, at: at}
+	if !prev.known {
+		// An initial level is not a transition.
+		return
+	}
+	for i, c := range s.cs {
+		switch c.kind {
+		case constraintSetupHold:
+			if name == c.b && c.slopeB.matches(on) {
+				s.clocks[i] = at
+				if d, ok := s.levels[c.a]; ok && d.changed && at-d.at < c.d1 {
+					s.violate(i, at, "%s changed %v before the clock edge, want %v", c.a, at-d.at, c.d1)
+				}
+			}
+			if name == c.a {
+				if t, ok := s.clocks[i]; ok && at-t < c.d2 {
+					s.violate(i, at, "%s changed %v after the clock edge, want %v", c.a, at-t, c.d2)
+				}
+			}
+		case constraintMinPulse:
+			if name == c.a && prev.on == c.on && prev.changed && at-prev.at < c.d1 {
+				s.violate(i, prev.at, "pulse lasted %v, want %v", at-prev.at, c.d1)
+			}
+		case constraintMaxLatency:
+			if name == c.b && c.slopeB.matches(on) {
+				s.pending[i] = nil
+			}
+			if name == c.a && c.slopeA.matches(on) {
+				s.pending[i] = append(s.pending[i], at)
+			}
+		}
+	}
+}
+
+// Checker evaluates timing constraints. It can check recorded signals
+// with Check() or CheckVCD(), and it is also a tracer (TimedTracer and
+// SourceLabeler) that checks the lines of a running Bank or Flag.
+type Checker struct {
+	cs []Constraint
+
+	// mu protects all subsequent fields.
+	mu sync.Mutex
+
+	// live holds the state of live checking, with times relative
+	// to origin.
+	live   *checkState
+	origin time.Time
+
+	// names holds the signal names of watched lines and values the
+	// most recent sample of each source.
+	names   map[vcdVar]string
+	watched map[vcdVar]bool
+	values  map[Named]uint64
+	masks   map[Named]uint64
+
+	violations []Violation
+	notify     func(Violation)
+}
+
+// NewChecker returns a checker for constraints cs.
+func NewChecker(cs ...Constraint) *Checker {
+	c := &Checker{
+		cs:      cs,
+		names:   make(map[vcdVar]string),
+		watched: make(map[vcdVar]bool),
+		values:  make(map[Named]uint64),
+		masks:   make(map[Named]uint64),
+		origin:  time.Now(),
+	}
+	c.live = newCheckState(cs, c.reportLocked)
+	return c
+}
+
+// Check evaluates the constraints over a set of named signals and
+// returns the violations in time order. Input transitions that are
+// not answered within a latency constraint by the last transition
+// of the signals are reported too.
+func (c *Checker) Check(signals map[string]Signal) []Violation {
+	return c.check(signals, 0)
+}
+
+// check evaluates the constraints over signals that were recorded
+// until at least end.
+func (c *Checker) check(signals map[string]Signal, end time.Duration) []Violation {
+	var vs []Violation
+	s := newCheckState(c.cs, func(v Violation) { vs = append(vs, v) })
+	// Coincident edges are fed in the order of their signals, so
+	// the names are sorted to make the results deterministic.
+	var names []string
+	for name := range signals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sigs []Signal
+	for _, name := range names {
+		sigs = append(sigs, signals[name])
+	}
+	for j, sig := range sigs {
+		if len(sig) != 0 {
+			s.feed(names[j], sig[0].At, sig[0].On)
+			if t := sig[len(sig)-1].At; t > end {
+				end = t
+			}
+		}
+	}
+	for _, e := range edges(sigs...) {
+		s.feed(names[e.signal], e.at, e.on)
+	}
+	s.expire(end)
+	sort.SliceStable(vs, func(i, j int) bool { return vs[i].At < vs[j].At })
+	return vs
+}
+
+// CheckVCD evaluates the constraints over the signals of a VCD.
+func (c *Checker) CheckVCD(v *VCD) ([]Violation, error) {
+	signals := make(map[string]Signal)
+	for _, k := range c.cs {
+		for _, name := range []string{k.a, k.b} {
+			if _, ok := signals[name]; ok || name == "" {
+				continue
+			}
+			s, err := v.Signal(name)
+			if err != nil {
+				return nil, err
+			}
+			signals[name] = s
+		}
+	}
+	return c.check(signals, v.End), nil
+}
+
+// Watch names the indexed line of src for live checking. Lines that
+// are not explicitly watched are named by the labels their source
+// provides.
+func (c *Checker) Watch(src Named, index int, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := vcdVar{src: src, index: index}
+	c.names[k] = name
+	c.watched[k] = true
+}
+
+// LabelLine names a line of src for live checking, unless it has been
+// explicitly watched.
+func (c *Checker) LabelLine(src Named, index int, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if k := (vcdVar{src: src, index: index}); !c.watched[k] {
+		c.names[k] = label
+	}
+	return nil
+}
+
+// Notify arranges for fn to be called with each live violation as it
+// is detected. It is called with the traced source locked, so it must
+// not call any source method other than Lines().
+func (c *Checker) Notify(fn func(Violation)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notify = fn
+}
+
+// reportLocked records a live violation.
+func (c *Checker) reportLocked(v Violation) {
+	c.violations = append(c.violations, v)
+	if c.notify != nil {
+		c.notify(v)
+	}
+}
+
+// TimedSample checks the line transitions of a Bank or Flag sample.
+// Live times are relative to the creation of the checker.
+func (c *Checker) TimedSample(when time.Time, src Named, mask, value uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old, oldMask := c.values[src], c.masks[src]
+	c.values[src] = (old &^ mask) | (value & mask)
+	c.masks[src] = oldMask | mask
+	at := when.Sub(c.origin)
+	pending := make([]int, len(c.cs))
+	for i := range c.cs {
+		pending[i] = len(c.live.pending[i])
+	}
+	for _, i := range unpackMask((mask &^ oldMask) | (mask & (value ^ old))) {
+		name, ok := c.names[vcdVar{src: src, index: int(i)}]
+		if !ok {
+			continue
+		}
+		c.live.feed(name, at, value&(uint64(1)<<i) != 0)
+	}
+	for i, k := range c.cs {
+		if len(c.live.pending[i]) <= pending[i] {
+			continue
+		}
+		// Report an unanswered input edge once it expires,
+		// even if nothing else changes.
+		time.AfterFunc(k.d1+time.Millisecond, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.live.expire(time.Since(c.origin))
+		})
+	}
+}
+
+// Violations returns the violations detected so far by live
+// checking.
+func (c *Checker) Violations() []Violation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Violation(nil), c.violations...)
+}
@@ -0,0 +1,80 @@
+package gpio
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	us := time.Microsecond
+	c := NewChecker(
+		SetupHold("data", "clk", SlopeRising, 2*us, 2*us),
+		MinPulse("clk", true, 3*us),
+		MaxLatency("req", SlopeRising, "ack", SlopeAny, 5*us),
+	)
+	signals := map[string]Signal{
+		//                 0         1         2
+		//                 012345678901234567890123456789
+		"clk":  wave(us, "000001111000011000001111000000"),
+		"data": wave(us, "001111111111110000011000000000"),
+		"req":  wave(us, "000000000000000000001000000000"),
+		"ack":  wave(us, "000000000000000000000011000000"),
+	}
+	signals["req"] = append(signals["req"], Level{At: 27 * us, On: true})
+	signals["ack"] = append(signals["ack"], Level{At: 40 * us, On: false})
+	var got []string
+	for _, v := range c.Check(signals) {
+		got = append(got, v.String())
+	}
+	want := []string{
+		"        13µs minimum high pulse of clk: pulse lasted 2µs, want 3µs",
+		"        14µs setup/hold data to clk rising edge: data changed 1µs after the clock edge, want 2µs",
+		"        20µs setup/hold data to clk rising edge: data changed 1µs before the clock edge, want 2µs",
+		"        21µs setup/hold data to clk rising edge: data changed 1µs after the clock edge, want 2µs",
+		"        27µs latency of req rising edge to ack any edge: no response within 5µs",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Live checking of a Flag.
+	f := NewFlag()
+	c.Watch(f, 0, "req")
+	c.Watch(f, 1, "ack")
+	var notified []Violation
+	c.Notify(func(v Violation) { notified = append(notified, v) })
+	f.SetTimedTracer(c)
+	f.Set(0, false)
+	f.Set(1, false)
+	f.Set(0, true)
+	time.Sleep(20 * time.Millisecond)
+	vs := c.Violations()
+	if len(vs) != 1 || !strings.HasPrefix(vs[0].Constraint, "latency of req") || vs[0].Detail != "no response within 5µs" {
+		t.Fatalf("got live violations %v", vs)
+	}
+	if len(notified) != 1 {
+		t.Errorf("notified of %d violations, want 1", len(notified))
+	}
+}
+
+func TestCheckerCoincident(t *testing.T) {
+	us := time.Microsecond
+	c := NewChecker(SetupHold("data", "clk", SlopeRising, 2*us, 2*us))
+	signals := map[string]Signal{
+		// The data changes at the same time as the clock edge.
+		"clk":  wave(us, "0000011110"),
+		"data": wave(us, "0000011111"),
+		"a":    wave(us, "0000010000"),
+		"z":    wave(us, "0000010000"),
+	}
+	// Coincident edges are ordered by signal name, so the clock
+	// edge is seen first.
+	want := "         5µs setup/hold data to clk rising edge: data changed 0s after the clock edge, want 2µs"
+	for i := 0; i < 20; i++ {
+		vs := c.Check(signals)
+		if len(vs) != 1 || vs[0].String() != want {
+			t.Fatalf("run %d got violations %v, want %q", i, vs, want)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"strconv"
@@ -15,7 +14,6 @@ import (
 	"time"
 
 	"zappem.net/pub/io/gpio"
-	"zappem.net/pub/io/iotracer"
 )
 
 var (
@@ -23,9 +21,21 @@ var (
 	trace   = flag.Bool("trace", false, "trace all IO")
 	poll    = flag.Duration("poll", 4*time.Millisecond, "poll interval for sampling inputs")
 	vcd     = flag.String("vcd", "", "name of VCD file for the IO trace of the program [ex. dump.vcd]")
+	csvFile = flag.String("csv", "", "name of CSV file for the IO trace of the program [ex. dump.csv]")
+	jsonl   = flag.String("jsonl", "", "name of JSON-lines file for the IO trace of the program [ex. dump.jsonl]")
 	tail    = flag.Duration("tail", 5*time.Second, "time to poll for")
 	pattern = flag.Bool("pattern", false, "run a test pattern on gpios")
 	changes = flag.Bool("changes", false, "count the number of IO changes")
+	trigger = flag.String("trigger", "", "capture the --vcd trace around a trigger: rising:<gpio>, falling:<gpio>, edge:<gpio> or pattern:<mask>:<value>")
+	pre     = flag.Duration("pre", 100*time.Millisecond, "duration of the --trigger capture before the trigger")
+	post    = flag.Duration("post", time.Second, "duration of the --trigger capture after the trigger")
+	replay  = flag.String("replay", "", "name of VCD file to replay onto the matching output gpios")
+	speed   = flag.Float64("speed", 1, "speed factor for --replay")
+	loop    = flag.Bool("loop", false, "repeat the --replay until --tail has elapsed")
+	golden  = flag.String("golden", "", "name of reference VCD file to compare the --vcd trace against")
+	tol     = flag.Duration("tolerance", time.Millisecond, "timing tolerance of the --golden comparison")
+	ignore  = flag.String("ignore", "", "comma separated signals the --golden comparison does not compare")
+	decode  = flag.String("decode", "", "decode the --vcd trace: uart:<rx>[:<baud>[:8N1]], spi:<sclk>:<mosi>[:<miso>[:<cs>[:<mode>]]], i2c:<scl>:<sda> or 1wire:<dq>")
 )
 
 // watcher is a rudimentary tracer abstraction.
@@ -47,6 +57,48 @@ func (w *watcher) Sample(mask, value uint64) {
 	}
 }
 
+// fileTracer is a tracer that writes to a file.
+type fileTracer interface {
+	gpio.TimedTracer
+	Add(src gpio.Named, module string)
+	Close() error
+}
+
+// openTrace creates the named trace file and returns a tracer,
+// generated by newTracer, that writes to it.
+func openTrace(name string, newTracer func(f *os.File) fileTracer) fileTracer {
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatalf("unable to create %q file: %v", name, err)
+	}
+	return newTracer(f)
+}
+
+// parseTrigger converts the --trigger flag value into a trigger for
+// lines of b.
+func parseTrigger(b *gpio.Bank, spec string) (gpio.Trigger, error) {
+	part := strings.Split(spec, ":")
+	var n []uint64
+	for _, v := range part[1:] {
+		x, err := strconv.ParseUint(v, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer: %v", v, err)
+		}
+		n = append(n, x)
+	}
+	switch {
+	case part[0] == "pattern" && len(n) == 2:
+		return gpio.PatternTrigger(b, n[0], n[1]), nil
+	case part[0] == "rising" && len(n) == 1:
+		return gpio.EdgeTrigger(b, int(n[0]), true, false), nil
+	case part[0] == "falling" && len(n) == 1:
+		return gpio.EdgeTrigger(b, int(n[0]), false, true), nil
+	case part[0] == "edge" && len(n) == 1:
+		return gpio.EdgeTrigger(b, int(n[0]), true, true), nil
+	}
+	return nil, fmt.Errorf("unrecognized trigger %q", spec)
+}
+
 // cycle watches some IO. If --pattern, it runs a test pattern.
 func cycle(ctx context.Context) {
 	part := strings.Split(*gpios, ":")
@@ -57,12 +109,48 @@ func cycle(ctx context.Context) {
 	if err != nil {
 		log.Fatalf("failed to open gpios %q: %v", part[0], err)
 	}
+	// The bank is closed first, flushing its tracer, before the
+	// trace outputs are closed.
+	var outputs []fileTracer
+	defer func() {
+		for _, out := range outputs {
+			if err := out.Close(); err != nil {
+				log.Fatalf("unable to write trace: %v", err)
+			}
+		}
+	}()
 	defer b.Close()
 
-	var tr *iotracer.Trace
-	if *trace && *vcd != "" {
-		tr = iotracer.NewTrace("gpioutil", 100)
-		tr.Module("rpi")
+	var capture *gpio.Capture
+	if *trigger != "" {
+		if !*trace || *vcd == "" {
+			log.Fatal("--trigger requires --trace and --vcd")
+		}
+		t, err := parseTrigger(b, *trigger)
+		if err != nil {
+			log.Fatalf("bad --trigger: %v", err)
+		}
+		capture = gpio.NewCapture(t, *pre, *post)
+		capture.Add(b, "rpi")
+	}
+
+	if *trace && *vcd != "" && capture == nil {
+		outputs = append(outputs, openTrace(*vcd, func(f *os.File) fileTracer {
+			return gpio.NewVCDWriter(f, "gpioutil", 100*time.Nanosecond, time.Second)
+		}))
+	}
+	if *trace && *csvFile != "" {
+		outputs = append(outputs, openTrace(*csvFile, func(f *os.File) fileTracer {
+			return gpio.NewCSVTracer(f)
+		}))
+	}
+	if *trace && *jsonl != "" {
+		outputs = append(outputs, openTrace(*jsonl, func(f *os.File) fileTracer {
+			return gpio.NewJSONTracer(f)
+		}))
+	}
+	for _, out := range outputs {
+		out.Add(b, "rpi")
 	}
 
 	max := -1
@@ -71,16 +159,13 @@ func cycle(ctx context.Context) {
 		for _, v := range strings.Split(part[1], ",") {
 			x, err := strconv.ParseInt(v, 0, 64)
 			if err != nil {
-				log.Fatalf("--gpios=...%q is not an integer: %v", err)
+				log.Fatalf("--gpios=...%q is not an integer: %v", v, err)
 			}
 			g := int(x)
 			li, err := b.LineInfo(g)
 			if err != nil {
 				log.Fatalf("failed to find GPIO[%d] for input: %v", g, err)
 			}
-			if tr != nil {
-				tr.Label(g, li.Label())
-			}
 			log.Printf("preparing %v for use as input", li)
 			if max < g {
 				max = g
@@ -94,16 +179,13 @@ func cycle(ctx context.Context) {
 		for _, v := range strings.Split(part[2], ",") {
 			x, err := strconv.ParseInt(v, 0, 64)
 			if err != nil {
-				log.Fatalf("--gpios=...%q is not an integer: %v", err)
+				log.Fatalf("--gpios=...%q is not an integer: %v", v, err)
 			}
 			g := int(x)
 			li, err := b.LineInfo(g)
 			if err != nil {
 				log.Fatalf("failed to find GPIO[%d] for output: %v", g, err)
 			}
-			if tr != nil {
-				tr.Label(g, li.Label())
-			}
 			log.Printf("preparing %v for use as output", li)
 			if max < g {
 				max = g
@@ -116,8 +198,17 @@ func cycle(ctx context.Context) {
 	}
 
 	if *trace {
-		if tr != nil {
-			b.SetTracer(tr)
+		if len(outputs) != 0 || capture != nil {
+			// Trace to the VCD, CSV and JSON-lines files and
+			// the trigger capture.
+			var tracers gpio.Tee
+			for _, out := range outputs {
+				tracers = append(tracers, out)
+			}
+			if capture != nil {
+				tracers = append(tracers, capture)
+			}
+			b.SetTimedTracer(tracers)
 		} else {
 			// Use the inlined simple tracer.
 			w := &watcher{
@@ -146,29 +237,139 @@ func cycle(ctx context.Context) {
 		}
 	}
 
-	if *pattern {
+	if *replay != "" {
+		p := gpio.NewPlayer(readVCD(*replay), *speed, *loop)
+		n, err := p.MapBank(b, "")
+		if err != nil {
+			log.Fatalf("unable to map %q outputs: %v", *replay, err)
+		}
+		log.Printf("replaying %d output(s) from %q", n, *replay)
+		pctx := ctx
+		if *loop {
+			var cancel context.CancelFunc
+			pctx, cancel = context.WithTimeout(ctx, *tail)
+			defer cancel()
+		}
+		if err := p.Play(pctx); err != nil && err != context.DeadlineExceeded {
+			log.Fatalf("replay failed: %v", err)
+		}
+	} else if *pattern {
 		for _, on := range []bool{true, false} {
+			b.Annotate(fmt.Sprintf("pattern setting outputs to %v", on))
 			for _, g := range outs {
 				b.Set(g, on)
 
 				time.Sleep(500 * time.Millisecond)
 			}
 		}
+	} else if capture != nil {
+		select {
+		case <-capture.Done():
+		case <-time.After(*tail):
+		}
 	} else if *tail != 0 {
 		time.Sleep(*tail)
 	}
 
-	if tr != nil {
-		rd, err := tr.VCD(100 * time.Nanosecond)
-		if err != nil {
-			log.Fatalf("unable to generate %q trace: %v", *vcd, err)
+	if capture != nil {
+		if _, ok := capture.When(); !ok {
+			log.Printf("trigger %q did not fire", *trigger)
+			return
 		}
 		f, err := os.Create(*vcd)
 		if err != nil {
 			log.Fatalf("unable to create %q file: %v", *vcd, err)
 		}
 		defer f.Close()
-		io.Copy(f, rd)
+		if err := capture.VCD(f, "gpioutil", 100*time.Nanosecond); err != nil {
+			log.Fatalf("unable to write %q trace: %v", *vcd, err)
+		}
+	}
+}
+
+// readVCD reads the named VCD file.
+func readVCD(name string) *gpio.VCD {
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatalf("unable to open %q: %v", name, err)
+	}
+	defer f.Close()
+	v, err := gpio.ReadVCD(f)
+	if err != nil {
+		log.Fatalf("unable to read %q: %v", name, err)
+	}
+	return v
+}
+
+// compareGolden compares the --vcd trace against the --golden one.
+func compareGolden() {
+	if *vcd == "" {
+		log.Fatal("--golden requires a --vcd trace to compare")
+	}
+	var ignored []string
+	if *ignore != "" {
+		ignored = strings.Split(*ignore, ",")
+	}
+	if err := gpio.CompareVCD(readVCD(*golden), readVCD(*vcd), *tol, ignored...); err != nil {
+		log.Fatalf("%q does not match %q: %v", *vcd, *golden, err)
+	}
+	log.Printf("%q matches %q", *vcd, *golden)
+}
+
+// decodeTrace prints the frames decoded from the --vcd trace.
+func decodeTrace() {
+	if *vcd == "" {
+		log.Fatal("--decode requires a --vcd trace to decode")
+	}
+	v := readVCD(*vcd)
+	part := strings.Split(*decode, ":")
+	signal := func(i int) gpio.Signal {
+		if i >= len(part) || part[i] == "" {
+			return nil
+		}
+		s, err := v.Signal(part[i])
+		if err != nil {
+			log.Fatalf("bad --decode signal: %v", err)
+		}
+		return s
+	}
+	number := func(i, def int) int {
+		if i >= len(part) || part[i] == "" {
+			return def
+		}
+		n, err := strconv.Atoi(part[i])
+		if err != nil {
+			log.Fatalf("--decode=...%q is not an integer: %v", part[i], err)
+		}
+		return n
+	}
+	if len(part) < 2 {
+		log.Fatalf("bad --decode=%q", *decode)
+	}
+	var frames []gpio.Frame
+	switch part[0] {
+	case "uart":
+		cfg := gpio.UARTConfig{Baud: number(2, 9600)}
+		if len(part) > 3 {
+			f := part[3]
+			if len(f) != 3 || !strings.Contains("NEO", f[1:2]) {
+				log.Fatalf("bad --decode UART format %q, want e.g. 8N1", f)
+			}
+			cfg.Bits, cfg.StopBits = int(f[0]-'0'), int(f[2]-'0')
+			cfg.Parity = gpio.Parity(strings.Index("NEO", f[1:2]))
+		}
+		frames = gpio.DecodeUART(signal(1), cfg)
+	case "spi":
+		frames = gpio.DecodeSPI(signal(1), signal(2), signal(3), signal(4), gpio.SPIConfig{Mode: number(5, 0)})
+	case "i2c":
+		frames = gpio.DecodeI2C(signal(1), signal(2))
+	case "1wire":
+		frames = gpio.DecodeOneWire(signal(1))
+	default:
+		log.Fatalf("unsupported --decode protocol %q", part[0])
+	}
+	for _, f := range frames {
+		fmt.Println(f)
 	}
 }
 
@@ -180,8 +381,17 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if *decode != "" {
+		decodeTrace()
+		return
+	}
 	if *gpios != "" {
 		cycle(ctx)
+	}
+	if *golden != "" {
+		compareGolden()
+	}
+	if *gpios != "" || *golden != "" {
 		return
 	}
 
@@ -0,0 +1,116 @@
+package gpio
+
+import "time"
+
+// TimedTracer is a richer form of the Tracer interface. Along with
+// the mask and value of a sample, it receives the time the sample was
+// observed and the source (a *Bank or *Flag) that generated it.
+type TimedTracer interface {
+	// TimedSample records a sample of masked data observed at
+	// time when. It is called with the source locked, so it must
+	// not call any source method other than Lines().
+	TimedSample(when time.Time, src Named, mask, value uint64)
+}
+
+// TimedNumTracer is the timestamped form of the NumTracer interface
+// for Vector values.
+type TimedNumTracer interface {
+	// TimedSampleNum records the new value of an indexed Vector
+	// value observed at time when. It is called with the source
+	// locked, so it must not call any source method other than
+	// Lines().
+	TimedSampleNum(when time.Time, src Named, index int, value int64)
+}
+
+// Labeler is implemented by tracers that accept labels for the lines
+// they trace. The *iotracer.Trace type implements it.
+type Labeler interface {
+	// Label names the line at index.
+	Label(index int, label string) error
+}
+
+// SourceLabeler is implemented by tracers that trace several sources
+// and accept labels for the lines of each. Like the samples, labels
+// are provided with the source locked, so LabelLine must not call
+// any source method other than Lines().
+type SourceLabeler interface {
+	// LabelLine names the line at index of src.
+	LabelLine(src Named, index int, label string) error
+}
+
+// Annotator is implemented by tracers that can record text markers,
+// annotations, in the timeline of their samples.
+type Annotator interface {
+	// Annotate records text as observed at time when for src. It
+	// is called with the source locked, so it must not call any
+	// source method other than Lines().
+	Annotate(when time.Time, src Named, text string)
+}
+
+// untimed adapts a Tracer to the TimedTracer interface.
+type untimed struct {
+	Tracer
+}
+
+// TimedSample records a sample with the adapted Tracer. If the Tracer
+// can record samples at a specified time, as *iotracer.Trace can, the
+// observation time is preserved.
+func (u untimed) TimedSample(when time.Time, src Named, mask, value uint64) {
+	if t, ok := u.Tracer.(interface {
+		SampleAt(time.Time, uint64, uint64)
+	}); ok {
+		t.SampleAt(when, mask, value)
+		return
+	}
+	u.Sample(mask, value)
+}
+
+// Label forwards a line label to the adapted Tracer if it is a
+// Labeler.
+func (u untimed) Label(index int, label string) error {
+	if l, ok := u.Tracer.(Labeler); ok {
+		return l.Label(index, label)
+	}
+	return nil
+}
+
+// Timed adapts a Tracer to the TimedTracer interface. If tracer
+// already implements TimedTracer it is returned unchanged.
+func Timed(tracer Tracer) TimedTracer {
+	if tracer == nil {
+		return nil
+	}
+	if t, ok := tracer.(TimedTracer); ok {
+		return t
+	}
+	return untimed{tracer}
+}
+
+// untimedNum adapts a NumTracer to the TimedNumTracer interface.
+type untimedNum struct {
+	NumTracer
+}
+
+// TimedSampleNum records a value with the adapted NumTracer,
+// preserving the observation time when the NumTracer supports it.
+func (u untimedNum) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	if t, ok := u.NumTracer.(interface {
+		SampleNumAt(time.Time, int, int64)
+	}); ok {
+		t.SampleNumAt(when, index, value)
+		return
+	}
+	u.SampleNum(index, value)
+}
+
+// TimedNum adapts a NumTracer to the TimedNumTracer interface. If
+// tracer already implements TimedNumTracer it is returned unchanged.
+func TimedNum(tracer NumTracer) TimedNumTracer {
+	if tracer == nil {
+		return nil
+	}
+	if t, ok := tracer.(TimedNumTracer); ok {
+		return t
+	}
+	return untimedNum{tracer}
+}
@@ -0,0 +1,56 @@
+package gpio
+
+import (
+	"testing"
+	"time"
+)
+
+// timedRecorder records the most recent timed sample.
+type timedRecorder struct {
+	when        time.Time
+	src         Named
+	mask, value uint64
+}
+
+func (r *timedRecorder) TimedSample(when time.Time, src Named, mask, value uint64) {
+	r.when, r.src, r.mask, r.value = when, src, mask, value
+}
+
+// atRecorder is an untimed Tracer that can record samples at a
+// specified time.
+type atRecorder struct {
+	when        time.Time
+	mask, value uint64
+}
+
+func (r *atRecorder) Sample(mask, value uint64) {
+	r.SampleAt(time.Time{}, mask, value)
+}
+
+func (r *atRecorder) SampleAt(when time.Time, mask, value uint64) {
+	r.when, r.mask, r.value = when, mask, value
+}
+
+func TestTimedTracer(t *testing.T) {
+	f := NewFlag()
+	r := &timedRecorder{}
+	f.SetTimedTracer(r)
+	before := time.Now()
+	f.Set(3, true)
+	f.Get(3) // synchronize with the completion of Set.
+	if r.src != f || r.mask != 8 || r.value != 8 {
+		t.Errorf("got src=%p mask=%x value=%x, want src=%p mask=8 value=8", r.src, r.mask, r.value, f)
+	}
+	if r.when.Before(before) {
+		t.Errorf("sample time %v precedes %v", r.when, before)
+	}
+
+	a := &atRecorder{}
+	f.SetTracer(a)
+	if a.when.IsZero() {
+		t.Error("adapted tracer did not receive the sample time")
+	}
+	if Timed(nil) != nil {
+		t.Error("Timed(nil) should be nil")
+	}
+}
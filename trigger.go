@@ -0,0 +1,226 @@
+package gpio
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Trigger decides if a change starts a triggered capture. It is
+// called for every traced change with the value of the change's
+// source after the change: for a Bank or Flag, this is the bit
+// pattern of all of the traced lines of the source, and for a Vector
+// it is the changed value.
+type Trigger func(ch Change, value uint64) bool
+
+// EdgeTrigger triggers on a rising (inactive to active) and/or
+// falling (active to inactive) edge of the indexed line of src. A
+// line with no previously known value is taken to be inactive, so the
+// first change of a line to active is a rising edge.
+func EdgeTrigger(src Named, index int, rising, falling bool) Trigger {
+	return func(ch Change, value uint64) bool {
+		if ch.Source != src || ch.Index != index || ch.Annotation() {
+			return false
+		}
+		old := ch.Old
+		if !ch.Known {
+			old = 0
+		}
+		return (rising && old == 0 && ch.New != 0) || (falling && old != 0 && ch.New == 0)
+	}
+}
+
+// PatternTrigger triggers when the masked bit pattern of src changes
+// to match value.
+func PatternTrigger(src Named, mask, value uint64) Trigger {
+	return func(ch Change, v uint64) bool {
+		return ch.Source == src && !ch.Annotation() && (uint64(1)<<ch.Index)&mask != 0 && v&mask == value&mask
+	}
+}
+
+// NoteTrigger triggers on an annotation of src with the given text.
+func NoteTrigger(src Named, text string) Trigger {
+	return func(ch Change, value uint64) bool {
+		return ch.Source == src && ch.Annotation() && ch.Text == text
+	}
+}
+
+// FlagTrigger triggers when the indexed flag is set.
+func FlagTrigger(f *Flag, index int) Trigger {
+	return EdgeTrigger(f, index, true, false)
+}
+
+// AnyTrigger triggers when any of the listed triggers does.
+func AnyTrigger(triggers ...Trigger) Trigger {
+	return func(ch Change, value uint64) bool {
+		for _, t := range triggers {
+			if t(ch, value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Capture is a tracer that works like a logic analyzer. It retains
+// the changes of the pre-trigger window in a Ring until its Trigger
+// fires, and then captures the changes until the post-trigger window
+// has elapsed.
+type Capture struct {
+	trigger   Trigger
+	pre, post time.Duration
+	ring      *Ring
+
+	// done is closed when the capture is complete.
+	done chan struct{}
+
+	// mu protects all subsequent fields.
+	mu       sync.Mutex
+	log      changeLog
+	at       time.Time
+	complete bool
+	captured []Change
+}
+
+// NewCapture returns a tracer that captures the changes from pre
+// before, until post after, the first change that fires trigger.
+func NewCapture(trigger Trigger, pre, post time.Duration) *Capture {
+	keep := pre
+	if keep <= 0 {
+		// A Ring with a zero keep duration is unlimited.
+		keep = time.Nanosecond
+	}
+	return &Capture{
+		trigger: trigger,
+		pre:     pre,
+		post:    post,
+		ring:    NewRing(0, keep),
+		done:    make(chan struct{}),
+	}
+}
+
+// Add registers src with the capture using module as its name.
+func (c *Capture) Add(src Named, module string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log.module(src, module)
+}
+
+// LabelLine names a line of src in subsequently recorded changes.
+func (c *Capture) LabelLine(src Named, index int, label string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.log.label(src, index, label)
+	return nil
+}
+
+// finishLocked completes the capture.
+func (c *Capture) finishLocked() {
+	if !c.complete {
+		c.complete = true
+		close(c.done)
+	}
+}
+
+// recordLocked records changes from src, checking for the trigger
+// until it has fired.
+func (c *Capture) recordLocked(src Named, chs []Change) {
+	if c.complete {
+		return
+	}
+	if !c.at.IsZero() {
+		for _, ch := range chs {
+			if ch.When.Sub(c.at) > c.post {
+				c.finishLocked()
+				return
+			}
+			c.captured = append(c.captured, ch)
+		}
+		return
+	}
+	value := c.log.source(src).value
+	for i, ch := range chs {
+		v := value
+		if ch.Numeric {
+			v = uint64(ch.New)
+		}
+		if !c.trigger(ch, v) {
+			continue
+		}
+		c.ring.record(chs[:i+1])
+		c.at = ch.When
+		c.captured = c.ring.snapshot()
+		start := c.at.Add(-c.pre)
+		for j := range c.captured {
+			if c.captured[j].When.Before(start) {
+				c.captured[j].When = start
+			}
+		}
+		c.captured = append(c.captured, chs[i+1:]...)
+		wait := c.post - time.Since(c.at)
+		if wait < 0 {
+			wait = 0
+		}
+		time.AfterFunc(wait, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.finishLocked()
+		})
+		return
+	}
+	c.ring.record(chs)
+}
+
+// TimedSample records the line changes of a Bank or Flag sample.
+func (c *Capture) TimedSample(when time.Time, src Named, mask, value uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recordLocked(src, c.log.sample(when, src, mask, value))
+}
+
+// TimedSampleNum records a change of a Vector value.
+func (c *Capture) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recordLocked(src, c.log.sampleNum(when, src, index, value))
+}
+
+// Annotate records an annotation of src, which may fire the trigger.
+func (c *Capture) Annotate(when time.Time, src Named, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recordLocked(src, c.log.annotate(when, src, text))
+}
+
+// Done returns a channel that is closed when the capture completes.
+func (c *Capture) Done() <-chan struct{} {
+	return c.done
+}
+
+// When returns the time of the triggering change, or false if the
+// trigger has not fired.
+func (c *Capture) When() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.at, !c.at.IsZero()
+}
+
+// Changes returns the captured changes in time order. Each line of
+// the pre-trigger window starts with its value at the beginning of
+// the window, if known. Until the trigger fires, no changes are
+// returned.
+func (c *Capture) Changes() []Change {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Change(nil), c.captured...)
+}
+
+// VCD writes the captured changes as a Value Change Dump to w. The
+// app names the top level VCD scope and tScale is the duration of one
+// VCD time unit.
+func (c *Capture) VCD(w io.Writer, app string, tScale time.Duration) error {
+	vw := NewVCDWriter(w, app, tScale, 0)
+	vw.c = nil
+	vw.record(c.Changes())
+	return vw.Flush()
+}
@@ -0,0 +1,93 @@
+package gpio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCapture(t *testing.T) {
+	f := NewFlag()
+	start := time.Now().Add(-time.Second)
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+	c := NewCapture(PatternTrigger(f, 6, 6), 25*time.Millisecond, 20*time.Millisecond)
+	for i, v := range []uint64{0, 1, 0, 1, 0, 2, 6, 7, 5, 4, 6} {
+		c.TimedSample(at(10*i), f, 7, v)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("capture did not complete")
+	}
+	when, ok := c.When()
+	if !ok || !when.Equal(at(60)) {
+		t.Fatalf("trigger time got=%v,%v want=%v", when, ok, at(60))
+	}
+	// The pre-trigger window starts at 35ms with the then current
+	// values, and the post-trigger window ends at 80ms.
+	chs := c.Changes()
+	type lv struct {
+		ms, index int
+		value     int64
+	}
+	want := []lv{
+		{35, 1, 0}, {35, 2, 0}, {35, 0, 1}, {40, 0, 0}, {50, 1, 1},
+		{60, 2, 1}, {70, 0, 1}, {80, 1, 0},
+	}
+	if len(chs) != len(want) {
+		t.Fatalf("got %d changes want %d: %v", len(chs), len(want), chs)
+	}
+	for i, w := range want {
+		ch := chs[i]
+		if !ch.When.Equal(at(w.ms)) || ch.Index != w.index || ch.New != w.value {
+			t.Errorf("change %d got=(%v,%d,%d) want=(%dms,%d,%d)", i, ch.When.Sub(start), ch.Index, ch.New, w.ms, w.index, w.value)
+		}
+	}
+	var buf bytes.Buffer
+	if err := c.VCD(&buf, "capture", time.Millisecond); err != nil {
+		t.Fatalf("VCD failed: %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, "#25\n") || !strings.Contains(got, "#45\n") {
+		t.Errorf("VCD lacks expected stamps:\n%s", got)
+	}
+}
+
+func TestFlagTrigger(t *testing.T) {
+	f := NewFlag()
+	c := NewCapture(FlagTrigger(f, 3), 0, 0)
+	f.SetTimedTracer(c)
+	if err := f.Set(2, true); err != nil {
+		t.Fatalf("failed to set flag 2: %v", err)
+	}
+	if err := f.Set(3, false); err != nil {
+		t.Fatalf("failed to clear flag 3: %v", err)
+	}
+	if _, ok := c.When(); ok {
+		t.Fatal("trigger fired before flag 3 was set")
+	}
+	if err := f.Set(3, true); err != nil {
+		t.Fatalf("failed to set flag 3: %v", err)
+	}
+	if _, ok := c.When(); !ok {
+		t.Fatal("first set of flag 3 did not fire trigger")
+	}
+}
+
+func TestEdgeTrigger(t *testing.T) {
+	f := NewFlag()
+	start := time.Now()
+	c := NewCapture(EdgeTrigger(f, 1, false, true), 0, 0)
+	for i, v := range []uint64{0, 2, 3, 1} {
+		c.TimedSample(start.Add(time.Duration(i)*time.Millisecond), f, 3, v)
+		if _, ok := c.When(); ok != (i == 3) {
+			t.Fatalf("sample %d: falling edge trigger fired=%v", i, ok)
+		}
+	}
+	when, _ := c.When()
+	if want := start.Add(3 * time.Millisecond); !when.Equal(want) {
+		t.Errorf("trigger time got=%v want=%v", when, want)
+	}
+}
@@ -0,0 +1,421 @@
+package gpio
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// txnSeq is the source of the ordering values assigned to each Bank,
+// Flag and Vector that participates in a transaction.
+var txnSeq uint64
+
+// orderOf lazily assigns a unique ordering value to a container. The
+// ordering value is used to acquire multiple holds in a deadlock free
+// order.
+func orderOf(seq *uint64) uint64 {
+	if n := atomic.LoadUint64(seq); n != 0 {
+		return n
+	}
+	atomic.CompareAndSwapUint64(seq, 0, atomic.AddUint64(&txnSeq, 1))
+	return atomic.LoadUint64(seq)
+}
+
+// holder is the transaction support implemented by each of the Bank,
+// Flag and Vector types.
+type holder interface {
+	// isNil indicates the container is a nil pointer.
+	isNil() bool
+	// order returns the lock acquisition order of the container.
+	order() uint64
+	// numeric indicates the container holds int64 values.
+	numeric() bool
+	// hold returns with the container locked and no SetHold()
+	// pending.
+	hold()
+	// release unlocks a held container.
+	release()
+	// checkLocked confirms that index can be updated.
+	checkLocked(index int) error
+	// getLocked returns the current value of index.
+	getLocked(index int) int64
+	// commitLocked applies all of the staged values at once.
+	commitLocked(staged map[int]int64) error
+}
+
+// Line identifies a single index of a Bank, Flag or Vector for use
+// in a transaction.
+type Line struct {
+	h     holder
+	index int
+}
+
+// BankLine identifies GPIO line g of Bank b.
+func BankLine(b *Bank, g int) Line {
+	return Line{h: b, index: g}
+}
+
+// FlagLine identifies the indexed bit of Flag f.
+func FlagLine(f *Flag, index int) Line {
+	return Line{h: f, index: index}
+}
+
+// VectorLine identifies the indexed value of Vector v.
+func VectorLine(v *Vector, index int) Line {
+	return Line{h: v, index: index}
+}
+
+// Txn holds a set of lines locked while values for them are staged.
+// The staged values are applied together by Commit().
+type Txn struct {
+	holders []holder
+	lines   map[Line]bool
+	staged  map[holder]map[int]int64
+}
+
+// Hold acquires holds on all of the listed lines, which may span any
+// number of Banks, Flags and Vectors. Like SetHold(), a hold covers
+// the whole container of each line, so all of the lines of a
+// container must be listed in the same transaction. Containers are
+// locked in a fixed global order, so concurrent transactions over
+// overlapping lines cannot deadlock. The caller must end the
+// transaction with Commit() or Release().
+func Hold(lines ...Line) (*Txn, error) {
+	t := &Txn{
+		lines:  make(map[Line]bool),
+		staged: make(map[holder]map[int]int64),
+	}
+	for _, l := range lines {
+		if l.h == nil || l.h.isNil() {
+			return nil, fmt.Errorf("line %d has no container", l.index)
+		}
+		t.lines[l] = true
+		if _, ok := t.staged[l.h]; !ok {
+			t.staged[l.h] = make(map[int]int64)
+			t.holders = append(t.holders, l.h)
+		}
+	}
+	sort.Slice(t.holders, func(i, j int) bool {
+		return t.holders[i].order() < t.holders[j].order()
+	})
+	for i, h := range t.holders {
+		h.hold()
+		for l := range t.lines {
+			if l.h != h {
+				continue
+			}
+			if err := h.checkLocked(l.index); err != nil {
+				for _, held := range t.holders[:i+1] {
+					held.release()
+				}
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// line confirms that l is held by this transaction.
+func (t *Txn) line(l Line, numeric bool) error {
+	if t == nil || t.lines == nil {
+		return fmt.Errorf("transaction not active")
+	}
+	if !t.lines[l] {
+		return fmt.Errorf("line %d is not held by this transaction", l.index)
+	}
+	if l.h.numeric() != numeric {
+		if numeric {
+			return fmt.Errorf("line %d has boolean values", l.index)
+		}
+		return fmt.Errorf("line %d has numerical values", l.index)
+	}
+	return nil
+}
+
+// value returns the staged, or if not staged the current, value of
+// a held line.
+func (t *Txn) value(l Line) int64 {
+	if v, ok := t.staged[l.h][l.index]; ok {
+		return v
+	}
+	return l.h.getLocked(l.index)
+}
+
+// Get returns the value of a held Bank or Flag line, including any
+// staged change.
+func (t *Txn) Get(l Line) (bool, error) {
+	if err := t.line(l, false); err != nil {
+		return false, err
+	}
+	return t.value(l) != 0, nil
+}
+
+// GetNum returns the value of a held Vector line, including any
+// staged change.
+func (t *Txn) GetNum(l Line) (int64, error) {
+	if err := t.line(l, true); err != nil {
+		return 0, err
+	}
+	return t.value(l), nil
+}
+
+// Set stages a value for a held Bank or Flag line.
+func (t *Txn) Set(l Line, on bool) error {
+	if err := t.line(l, false); err != nil {
+		return err
+	}
+	var v int64
+	if on {
+		v = 1
+	}
+	t.staged[l.h][l.index] = v
+	return nil
+}
+
+// SetNum stages a value for a held Vector line.
+func (t *Txn) SetNum(l Line, value int64) error {
+	if err := t.line(l, true); err != nil {
+		return err
+	}
+	t.staged[l.h][l.index] = value
+	return nil
+}
+
+// Commit applies all of the staged values and releases the holds of
+// the transaction. Each container applies its staged values at once.
+// A Bank or Flag generates at most one trace sample, and a Vector
+// generates one sample per changed value, all with the same
+// timestamp. The first error encountered is returned, but all holds
+// are released regardless.
+func (t *Txn) Commit() error {
+	if t == nil || t.lines == nil {
+		return fmt.Errorf("transaction not active")
+	}
+	var err error
+	for _, h := range t.holders {
+		if staged := t.staged[h]; len(staged) != 0 {
+			if e := h.commitLocked(staged); err == nil {
+				err = e
+			}
+		}
+	}
+	t.Release()
+	return err
+}
+
+// Release abandons any staged values and releases the holds of the
+// transaction.
+func (t *Txn) Release() {
+	if t == nil || t.lines == nil {
+		return
+	}
+	for i := len(t.holders) - 1; i >= 0; i-- {
+		t.holders[i].release()
+	}
+	t.holders = nil
+	t.lines = nil
+	t.staged = nil
+}
+
+// isNil indicates the Bank is not usable.
+func (b *Bank) isNil() bool {
+	return b == nil
+}
+
+// order returns the transaction lock order for the Bank.
+func (b *Bank) order() uint64 {
+	return orderOf(&b.seq)
+}
+
+// numeric indicates that the Bank holds boolean values.
+func (b *Bank) numeric() bool {
+	return false
+}
+
+// hold locks the bank once no SetHold() is pending.
+func (b *Bank) hold() {
+	b.mu.Lock()
+	for b.setCh != nil {
+		b.mu.Unlock()
+		runtime.Gosched()
+		b.mu.Lock()
+	}
+}
+
+// release unlocks a held bank.
+func (b *Bank) release() {
+	b.mu.Unlock()
+}
+
+// checkLocked confirms that the GPIO, g, is write-enabled.
+func (b *Bank) checkLocked(g int) error {
+	if err := b.valid(g); err != nil {
+		return err
+	}
+	if b.outsMask&(uint64(1)<<g) == 0 {
+		return fmt.Errorf("%d is not write-enabled in %q bank", g, b.name)
+	}
+	return nil
+}
+
+// getLocked returns the cached output value of GPIO g.
+func (b *Bank) getLocked(g int) int64 {
+	return int64((b.outs >> g) & 1)
+}
+
+// commitLocked updates all of the staged outputs with a single
+// kernel call.
+func (b *Bank) commitLocked(staged map[int]int64) error {
+	old, outs := b.outs, b.outs
+	for g, on := range staged {
+		bit := uint64(1) << g
+		if on != 0 {
+			outs |= bit
+		} else {
+			outs &^= bit
+		}
+	}
+	if old == outs {
+		return nil
+	}
+	// setOutsLocked writes b.outs, so restore the cached value if the
+	// hardware was not updated.
+	b.outs = outs
+	if err := b.setOutsLocked(); err != nil {
+		b.outs = old
+		return err
+	}
+	return nil
+}
+
+// isNil indicates the Flag is not usable.
+func (f *Flag) isNil() bool {
+	return f == nil
+}
+
+// order returns the transaction lock order for the Flag.
+func (f *Flag) order() uint64 {
+	return orderOf(&f.seq)
+}
+
+// numeric indicates that the Flag holds boolean values.
+func (f *Flag) numeric() bool {
+	return false
+}
+
+// hold locks the flags once no SetHold() is pending.
+func (f *Flag) hold() {
+	f.mu.Lock()
+	for f.setCh != nil {
+		f.mu.Unlock()
+		runtime.Gosched()
+		f.mu.Lock()
+	}
+}
+
+// release unlocks held flags.
+func (f *Flag) release() {
+	f.mu.Unlock()
+}
+
+// checkLocked confirms the flag index is valid.
+func (f *Flag) checkLocked(index int) error {
+	return f.valid(index)
+}
+
+// getLocked returns the value of the indexed flag.
+func (f *Flag) getLocked(index int) int64 {
+	return int64((f.value >> index) & 1)
+}
+
+// commitLocked updates all of the staged flags, delivers the
+// transitions of watched flags, and generates a single trace sample
+// if anything changed.
+func (f *Flag) commitLocked(staged map[int]int64) error {
+	now := time.Now()
+	oldMask, old := f.mask, f.value
+	var indices []int
+	for index := range staged {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		bit := uint64(1) << index
+		on := staged[index] != 0
+		f.mask |= bit
+		if on == (f.value&bit != 0) {
+			continue
+		}
+		f.value ^= bit
+		f.edgeLocked(now, index, on)
+	}
+	if f.tracer != nil && (old != f.value || oldMask != f.mask) {
+		f.tracer.TimedSample(now, f, f.mask, f.value)
+	}
+	return nil
+}
+
+// isNil indicates the Vector is not usable.
+func (v *Vector) isNil() bool {
+	return v == nil
+}
+
+// order returns the transaction lock order for the Vector.
+func (v *Vector) order() uint64 {
+	return orderOf(&v.seq)
+}
+
+// numeric indicates that the Vector holds numerical values.
+func (v *Vector) numeric() bool {
+	return true
+}
+
+// hold locks the vector once no SetHold() is pending.
+func (v *Vector) hold() {
+	v.mu.Lock()
+	for v.setCh != nil {
+		v.mu.Unlock()
+		runtime.Gosched()
+		v.mu.Lock()
+	}
+}
+
+// release unlocks a held vector.
+func (v *Vector) release() {
+	v.mu.Unlock()
+}
+
+// checkLocked confirms the vector index is valid.
+func (v *Vector) checkLocked(index int) error {
+	return v.valid(index)
+}
+
+// getLocked returns the indexed vector value.
+func (v *Vector) getLocked(index int) int64 {
+	return v.val[index]
+}
+
+// commitLocked updates all of the staged vector values. Since a
+// numerical trace sample holds a single value, a sample is generated
+// for each changed value, in index order and with a common timestamp.
+func (v *Vector) commitLocked(staged map[int]int64) error {
+	now := time.Now()
+	var indices []int
+	for index := range staged {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		value := staged[index]
+		if v.val[index] == value {
+			continue
+		}
+		v.val[index] = value
+		if v.tracer != nil {
+			v.tracer.TimedSampleNum(now, v, index, value)
+		}
+	}
+	return nil
+}
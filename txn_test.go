@@ -0,0 +1,133 @@
+package gpio
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// counter is a Tracer that counts samples.
+type counter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *counter) Sample(mask, value uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n++
+}
+
+// numCounter is a TimedNumTracer that counts samples and records
+// their timestamps.
+type numCounter struct {
+	mu   sync.Mutex
+	when []time.Time
+}
+
+func (c *numCounter) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.when = append(c.when, when)
+}
+
+func TestTxn(t *testing.T) {
+	f := NewFlag()
+	v := NewVector(3)
+	c := &counter{}
+	f.SetTracer(c)
+	c.n = 0
+
+	a, b, n := FlagLine(f, 1), FlagLine(f, 5), VectorLine(v, 2)
+	txn, err := Hold(a, b, n)
+	if err != nil {
+		t.Fatalf("failed to hold lines: %v", err)
+	}
+	if err := txn.Set(a, true); err != nil {
+		t.Fatalf("failed to stage flag[1]: %v", err)
+	}
+	if err := txn.Set(b, true); err != nil {
+		t.Fatalf("failed to stage flag[5]: %v", err)
+	}
+	if err := txn.SetNum(n, 7); err != nil {
+		t.Fatalf("failed to stage vec[2]: %v", err)
+	}
+	if err := txn.SetNum(a, 7); err == nil {
+		t.Error("staged a number for a flag")
+	}
+	if err := txn.Set(FlagLine(f, 2), true); err == nil {
+		t.Error("staged a value for an unheld line")
+	}
+	if on, err := txn.Get(b); err != nil || !on {
+		t.Errorf("staged flag[5] got=%v,%v want=true,<nil>", on, err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if c.n != 1 {
+		t.Errorf("commit generated %d samples, want 1", c.n)
+	}
+	for _, i := range []int{1, 5} {
+		if on, err := f.Get(i); err != nil || !on {
+			t.Errorf("flag[%d] got=%v,%v want=true,<nil>", i, on, err)
+		}
+	}
+	if x, err := v.Get(2); err != nil || x != 7 {
+		t.Errorf("vec[2] got=%v,%v want=7,<nil>", x, err)
+	}
+
+	// A vector commit generates one sample per changed value, all
+	// sharing the same timestamp.
+	nc := &numCounter{}
+	v.SetTimedTracer(nc)
+	nc.when = nil
+	m := VectorLine(v, 0)
+	if txn, err = Hold(m, n); err != nil {
+		t.Fatalf("failed to hold vector lines: %v", err)
+	}
+	txn.SetNum(m, 3)
+	txn.SetNum(n, 7)
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("vector commit failed: %v", err)
+	}
+	if len(nc.when) != 1 {
+		t.Errorf("partly unchanged vector commit generated %d samples, want 1", len(nc.when))
+	}
+	if txn, err = Hold(m, n); err != nil {
+		t.Fatalf("failed to re-hold vector lines: %v", err)
+	}
+	txn.SetNum(m, 4)
+	txn.SetNum(n, 8)
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("vector commit failed: %v", err)
+	}
+	if len(nc.when) != 3 || !nc.when[1].Equal(nc.when[2]) {
+		t.Errorf("vector commit samples at %v, want two with the same timestamp", nc.when[1:])
+	}
+	v.SetTimedTracer(nil)
+
+	// Overlapping transactions in opposite orders must not
+	// deadlock.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if txn, err := Hold(a, n); err == nil {
+				txn.SetNum(n, 1)
+				txn.Commit()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if txn, err := Hold(n, b); err == nil {
+				txn.Set(b, false)
+				txn.Release()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := f.Set(1, false); err != nil {
+		t.Errorf("flag still held after transactions: %v", err)
+	}
+}
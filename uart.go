@@ -0,0 +1,319 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// UART is a software UART that transmits by bit-banging one line, and
+// receives by decoding the timestamped transitions of another. It
+// implements io.ReadWriter, so serial protocol code can run over plain
+// GPIO lines. The receive line must be provided by a Watcher, such as
+// a Bank or a Flag.
+type UART struct {
+	io     IO[bool]
+	tx, rx int
+	cfg    UARTConfig
+	bit    time.Duration
+
+	// wmu serializes writes.
+	wmu sync.Mutex
+
+	// mu protects all subsequent fields. cond is signaled when any
+	// of them change.
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// queue holds the received characters not yet read, and closed
+	// indicates no more will be received.
+	queue  []uartChar
+	closed bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// uartChar holds a received character and any error detected while
+// decoding it.
+type uartChar struct {
+	b   byte
+	err error
+}
+
+// NewUART returns a UART that transmits on line tx and receives on
+// line rx of io, with the line settings cfg. Either tx or rx can be
+// -1 for a one-way UART. The tx line is set idle (high) and
+// characters are received until ctx is done or Close() is called.
+func NewUART(ctx context.Context, io IO[bool], tx, rx int, cfg UARTConfig) (*UART, error) {
+	cfg = cfg.defaults()
+	if cfg.Baud <= 0 {
+		return nil, fmt.Errorf("invalid UART baud rate %d", cfg.Baud)
+	}
+	if cfg.Bits < 5 || cfg.Bits > 8 {
+		return nil, fmt.Errorf("invalid UART data bits %d", cfg.Bits)
+	}
+	if cfg.StopBits < 1 || cfg.StopBits > 2 {
+		return nil, fmt.Errorf("invalid UART stop bits %d", cfg.StopBits)
+	}
+	if cfg.Parity < ParityNone || cfg.Parity > ParityOdd {
+		return nil, fmt.Errorf("invalid UART parity %d", cfg.Parity)
+	}
+	u := &UART{
+		io:   io,
+		tx:   tx,
+		rx:   rx,
+		cfg:  cfg,
+		bit:  time.Second / time.Duration(cfg.Baud),
+		done: make(chan struct{}),
+	}
+	u.cond = sync.NewCond(&u.mu)
+	if tx >= 0 {
+		if err := io.Set(tx, true); err != nil {
+			return nil, err
+		}
+	}
+	if rx < 0 {
+		u.closed = true
+		close(u.done)
+		return u, nil
+	}
+	w, ok := io.(Watcher)
+	if !ok {
+		return nil, fmt.Errorf("UART receive line %q cannot be watched", io.Label(rx))
+	}
+	level, err := io.Get(rx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, u.cancel = context.WithCancel(ctx)
+	edges, err := w.Watch(ctx, rx)
+	if err != nil {
+		u.cancel()
+		return nil, err
+	}
+	go u.receive(edges, level)
+	return u, nil
+}
+
+// Close stops receiving. Buffered characters can still be read, after
+// which Read() returns io.EOF.
+func (u *UART) Close() error {
+	if u.cancel != nil {
+		u.cancel()
+	}
+	<-u.done
+	return nil
+}
+
+// Write transmits the bytes of p, blocking until they have all been
+// sent. For fewer than 8 data bits, the high bits of each byte are
+// ignored.
+func (u *UART) Write(p []byte) (int, error) {
+	if u.tx < 0 {
+		return 0, errors.New("UART has no transmit line")
+	}
+	u.wmu.Lock()
+	defer u.wmu.Unlock()
+	var pc pacer
+	pc.start()
+	for i, b := range p {
+		levels := []bool{false}
+		for j := 0; j < u.cfg.Bits; j++ {
+			levels = append(levels, b>>j&1 != 0)
+		}
+		if u.cfg.Parity != ParityNone {
+			ones := bits.OnesCount8(b & byte(1<<u.cfg.Bits-1))
+			levels = append(levels, (ones%2 == 0) != (u.cfg.Parity == ParityEven))
+		}
+		for j := 0; j < u.cfg.StopBits; j++ {
+			levels = append(levels, true)
+		}
+		for _, on := range levels {
+			if err := u.io.Set(u.tx, on); err != nil {
+				return i, err
+			}
+			pc.wait(u.bit)
+		}
+	}
+	return len(p), nil
+}
+
+// Read reads received characters into p, blocking until at least one
+// is available. A character received with a framing or parity error
+// is reported, on its own, with an error that wraps ErrFraming or
+// ErrParity. Once the UART is closed and all the received characters
+// have been read, Read returns io.EOF.
+func (u *UART) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for len(u.queue) == 0 && !u.closed {
+		u.cond.Wait()
+	}
+	if len(u.queue) == 0 {
+		return 0, io.EOF
+	}
+	if c := u.queue[0]; c.err != nil {
+		u.queue = u.queue[1:]
+		return 0, fmt.Errorf("UART received 0x%02x: %w", c.b, c.err)
+	}
+	n := 0
+	for n < len(p) && n < len(u.queue) && u.queue[n].err == nil {
+		p[n] = u.queue[n].b
+		n++
+	}
+	u.queue = u.queue[n:]
+	return n, nil
+}
+
+// Buffered returns the number of received characters that have not
+// yet been read.
+func (u *UART) Buffered() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.queue)
+}
+
+// uartLatency allows for the delay between a transition of a watched
+// line and the delivery of its edge.
+const uartLatency = time.Millisecond
+
+// uartReceiver reconstructs characters from the transitions of an
+// idle high line. Each bit is sampled at its midpoint.
+type uartReceiver struct {
+	cfg   UARTConfig
+	bit   float64
+	level bool
+
+	// active indicates a character is being received since start,
+	// and k is the index of its next bit sample.
+	active bool
+	start  time.Time
+	k      int
+	value  uint64
+
+	deliver func(uartChar)
+}
+
+// samples returns the number of samples of a character, including the
+// start and stop bits.
+func (r *uartReceiver) samples() int {
+	n := 1 + r.cfg.Bits + r.cfg.StopBits
+	if r.cfg.Parity != ParityNone {
+		n++
+	}
+	return n
+}
+
+// sampleAt returns the time of sample k of the current character.
+func (r *uartReceiver) sampleAt(k int) time.Time {
+	return r.start.Add(time.Duration((float64(k) + 0.5) * r.bit))
+}
+
+// advance takes the samples of the current character that precede t,
+// which are all at the current level of the line.
+func (r *uartReceiver) advance(t time.Time) {
+	for r.active && r.sampleAt(r.k).Before(t) {
+		if r.level {
+			r.value |= 1 << r.k
+		}
+		if r.k == 0 && r.level {
+			// Too short to be a start bit.
+			r.active = false
+			return
+		}
+		if r.k++; r.k == r.samples() {
+			r.active = false
+			r.finish()
+		}
+	}
+}
+
+// edge applies a transition of the line, which starts a character if
+// the line falls while idle.
+func (r *uartReceiver) edge(e Edge) {
+	r.advance(e.When)
+	r.level = e.On
+	if !r.active && !e.On {
+		r.active, r.start, r.k, r.value = true, e.When, 0, 0
+	}
+}
+
+// finish delivers the received character.
+func (r *uartReceiver) finish() {
+	mask := uint64(1)<<r.cfg.Bits - 1
+	c := uartChar{b: byte(r.value >> 1 & mask)}
+	n := 1 + r.cfg.Bits
+	if r.cfg.Parity != ParityNone {
+		ones := bits.OnesCount64(r.value >> 1 & (mask<<1 | 1))
+		if (ones%2 == 0) != (r.cfg.Parity == ParityEven) {
+			c.err = ErrParity
+		}
+		n++
+	}
+	if stop := uint64(1)<<r.cfg.StopBits - 1; r.value>>n&stop != stop {
+		c.err = ErrFraming
+	}
+	r.deliver(c)
+}
+
+// receive decodes characters from the edges of the rx line until the
+// edge channel is closed.
+func (u *UART) receive(edges <-chan Edge, level bool) {
+	defer close(u.done)
+	r := &uartReceiver{
+		cfg:   u.cfg,
+		bit:   float64(time.Second) / float64(u.cfg.Baud),
+		level: level,
+		deliver: func(c uartChar) {
+			u.mu.Lock()
+			defer u.mu.Unlock()
+			u.queue = append(u.queue, c)
+			u.cond.Broadcast()
+		},
+	}
+	defer func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.closed = true
+		u.cond.Broadcast()
+	}()
+	for {
+		if !r.active {
+			e, ok := <-edges
+			if !ok {
+				return
+			}
+			r.edge(e)
+			continue
+		}
+		// Complete the character once its final sample is due, if no
+		// further edges arrive, allowing for their delivery latency.
+		t := time.NewTimer(time.Until(r.sampleAt(r.samples()-1)) + uartLatency)
+		select {
+		case e, ok := <-edges:
+			t.Stop()
+			if !ok {
+				return
+			}
+			r.edge(e)
+		case <-t.C:
+			select {
+			case e, ok := <-edges:
+				if !ok {
+					return
+				}
+				r.edge(e)
+			default:
+				r.advance(time.Now())
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// uartWire simulates a serial line. Since a UART transmitter sets the
+// line once per bit, each Set() advances a virtual clock by one bit,
+// which makes the edges independent of scheduling delays. The edges
+// are delivered to the watcher by flush().
+type uartWire struct {
+	bit       time.Duration
+	start, at time.Time
+	level     bool
+	sig       Signal
+	edges     []Edge
+	ch        chan Edge
+}
+
+func newUARTWire(baud int) *uartWire {
+	start := time.Now().Add(-time.Second)
+	return &uartWire{
+		bit:   time.Second / time.Duration(baud),
+		start: start,
+		at:    start,
+		level: true,
+		sig:   Signal{{On: true}},
+	}
+}
+
+func (w *uartWire) Lines() int             { return 1 }
+func (w *uartWire) Label(index int) string { return "wire" }
+func (w *uartWire) SetAlias(name string)   {}
+func (w *uartWire) SetHold(index int) (chan<- bool, error) {
+	return nil, errors.New("not supported")
+}
+
+func (w *uartWire) Get(index int) (bool, error) {
+	return w.level, nil
+}
+
+func (w *uartWire) Set(index int, on bool) error {
+	w.at = w.at.Add(w.bit)
+	if on != w.level {
+		w.level = on
+		w.edges = append(w.edges, Edge{When: w.at, On: on})
+		w.sig = append(w.sig, Level{At: w.at.Sub(w.start), On: on})
+	}
+	return nil
+}
+
+func (w *uartWire) Watch(ctx context.Context, index int) (<-chan Edge, error) {
+	w.ch = make(chan Edge, edgeDepth)
+	go func() {
+		<-ctx.Done()
+		close(w.ch)
+	}()
+	return w.ch, nil
+}
+
+// flush delivers the pending edges.
+func (w *uartWire) flush() {
+	for _, e := range w.edges {
+		w.ch <- e
+	}
+	w.edges = nil
+}
+
+// readTimeout reads n bytes from r, or fails after a timeout.
+func readTimeout(t *testing.T, r io.Reader, n int) ([]byte, error) {
+	t.Helper()
+	type result struct {
+		b   []byte
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		ch <- result{b, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.b, res.err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out reading %d bytes", n)
+	}
+	return nil, nil
+}
+
+func TestUART(t *testing.T) {
+	for _, cfg := range []UARTConfig{
+		{Baud: 115200},
+		{Baud: 57600, Bits: 7, Parity: ParityEven},
+		{Baud: 115200, Parity: ParityOdd, StopBits: 2},
+	} {
+		w := newUARTWire(cfg.Baud)
+		u, err := NewUART(context.Background(), w, 0, 0, cfg)
+		if err != nil {
+			t.Fatalf("NewUART(%+v) failed: %v", cfg, err)
+		}
+		msg := "Hello, World\x00\x7f"
+		if n, err := u.Write([]byte(msg)); err != nil || n != len(msg) {
+			t.Fatalf("%+v: Write returned %d, %v", cfg, n, err)
+		}
+		w.flush()
+		got, err := readTimeout(t, u, len(msg))
+		if err != nil {
+			t.Fatalf("%+v: read failed: %v", cfg, err)
+		}
+		if string(got) != msg {
+			t.Errorf("%+v: read %q, want %q", cfg, got, msg)
+		}
+		u.Close()
+		if n, err := u.Read(got); n != 0 || err != io.EOF {
+			t.Errorf("%+v: read after close returned %d, %v", cfg, n, err)
+		}
+
+		var decoded []byte
+		for _, fr := range DecodeUART(w.sig, cfg) {
+			if fr.Err != nil {
+				t.Errorf("%+v: decoded %v", cfg, fr)
+			}
+			decoded = append(decoded, byte(fr.Value))
+		}
+		if string(decoded) != msg {
+			t.Errorf("%+v: decoded %q, want %q", cfg, decoded, msg)
+		}
+	}
+}
+
+func TestUARTErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i, test := range []struct {
+		tx, rx UARTConfig
+		data   byte
+		want   error
+	}{
+		{
+			tx:   UARTConfig{Baud: 9600, Parity: ParityEven},
+			rx:   UARTConfig{Baud: 9600, Parity: ParityOdd},
+			data: 'a',
+			want: ErrParity,
+		},
+		{
+			// The parity bit, zero for 0x03, is the second stop
+			// bit of a 7 data bit receiver.
+			tx:   UARTConfig{Baud: 9600, Bits: 8, Parity: ParityEven},
+			rx:   UARTConfig{Baud: 9600, Bits: 7, Parity: ParityEven, StopBits: 2},
+			data: 0x03,
+			want: ErrFraming,
+		},
+	} {
+		w := newUARTWire(9600)
+		tx, err := NewUART(ctx, w, 0, -1, test.tx)
+		if err != nil {
+			t.Fatalf("test %d: NewUART failed: %v", i, err)
+		}
+		rx, err := NewUART(ctx, w, -1, 0, test.rx)
+		if err != nil {
+			t.Fatalf("test %d: NewUART failed: %v", i, err)
+		}
+		if _, err := rx.Write([]byte{1}); err == nil {
+			t.Errorf("test %d: write to receive only UART succeeded", i)
+		}
+		if _, err := tx.Write([]byte{test.data}); err != nil {
+			t.Fatalf("test %d: Write failed: %v", i, err)
+		}
+		w.flush()
+		if _, err := readTimeout(t, rx, 1); !errors.Is(err, test.want) {
+			t.Errorf("test %d: read returned %v, want %v", i, err, test.want)
+		}
+	}
+
+	w := newUARTWire(9600)
+	if _, err := NewUART(ctx, w, 0, 1, UARTConfig{}); err == nil {
+		t.Error("zero baud rate accepted")
+	}
+	if _, err := NewUART(ctx, w, 0, 1, UARTConfig{Baud: 9600, Bits: 9}); err == nil {
+		t.Error("9 data bits accepted")
+	}
+	if _, err := NewUART(ctx, newI2CSim(), 0, 1, UARTConfig{Baud: 9600}); err == nil {
+		t.Error("unwatchable receive line accepted")
+	}
+}
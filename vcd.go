@@ -0,0 +1,419 @@
+package gpio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vcdVar identifies a single VCD variable.
+type vcdVar struct {
+	src   Named
+	index int
+}
+
+// VCDWriter is a tracer that streams a Value Change Dump to an
+// io.Writer as samples arrive. Bank lines and Flag bits are declared
+// as wire variables, and Vector values as integer variables.
+// Annotations are written as VCD comments at their place in the
+// timeline.
+//
+// Since VCD variables must be declared before any value changes are
+// written, the definitions are written when the first change is
+// recorded, or by Begin(), and from then on changes are written as
+// they arrive. Only the lines traced by then, and those labeled with
+// LabelLine(), are declared. Sources first seen before the
+// definitions are written are added with default scope names.
+// Changes to lines that were not declared cannot be recorded, and are
+// reported as an error by Flush() and Close().
+type VCDWriter struct {
+	app    string
+	tScale time.Duration
+	period time.Duration
+
+	// mu protects all subsequent fields.
+	mu sync.Mutex
+
+	w   *bufio.Writer
+	c   io.Closer
+	log changeLog
+	err error
+
+	// added holds the sources registered before the definitions
+	// were written and vars holds the declared lines. The VCD
+	// identifiers of the lines are assigned when the definitions
+	// are written.
+	added map[Named]bool
+	vars  map[vcdVar]string
+
+	// scales holds the scale factors of the numerical variables
+	// that are written as real variables.
+	scales map[vcdVar]float64
+
+	// begun indicates the definitions have been written.
+	begun bool
+
+	// start is the time of the VCD timestamp #0 and stamp is the
+	// most recently written timestamp.
+	start time.Time
+	stamp uint64
+
+	// flushing indicates a periodic flush is scheduled.
+	flushing bool
+}
+
+// NewVCDWriter returns a VCD tracer that streams to w. The app names
+// the top level VCD scope and tScale is the duration of one VCD time
+// unit. While tracing, the output is flushed at least once per period,
+// so a partially written file remains viewable. If w is an io.Closer,
+// it is closed by Close().
+func NewVCDWriter(w io.Writer, app string, tScale, period time.Duration) *VCDWriter {
+	if app == "" {
+		app = "gpio"
+	}
+	if tScale <= 0 {
+		tScale = time.Nanosecond
+	}
+	v := &VCDWriter{
+		app:    app,
+		tScale: tScale,
+		period: period,
+		w:      bufio.NewWriter(w),
+		added:  make(map[Named]bool),
+		vars:   make(map[vcdVar]string),
+		scales: make(map[vcdVar]float64),
+	}
+	v.c, _ = w.(io.Closer)
+	return v
+}
+
+// Add registers src with the writer using module as its VCD scope.
+// Bank lines are labeled with their LineLabel(). Sources must be
+// added before the definitions are written.
+func (v *VCDWriter) Add(src Named, module string) {
+	var labels []string
+	if b, ok := src.(*Bank); ok {
+		for g := 0; g < b.Lines(); g++ {
+			labels = append(labels, b.LineLabel(g))
+		}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.addLocked(src) && v.err == nil {
+		v.err = fmt.Errorf("%q added after the VCD definitions were written", module)
+	}
+	v.log.module(src, module)
+	t := v.log.source(src)
+	for g, label := range labels {
+		if t.labels[g] == "" {
+			t.labels[g] = label
+		}
+	}
+}
+
+// LabelLine names and declares a line of src. Labels must be
+// provided before the definitions are written.
+func (v *VCDWriter) LabelLine(src Named, index int, label string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	t := v.log.source(src)
+	if v.begun && t.label(index) != label {
+		return fmt.Errorf("line %d of %q already declared as %q", index, t.module, t.label(index))
+	}
+	v.log.label(src, index, label)
+	if index >= 0 && index < src.Lines() {
+		v.addLocked(src)
+		v.declareLocked(src, index)
+	}
+	return nil
+}
+
+// addLocked registers src, unless it is already registered. It
+// returns false if src is new but the definitions have already been
+// written.
+func (v *VCDWriter) addLocked(src Named) bool {
+	if v.added[src] {
+		return true
+	}
+	if v.begun {
+		return false
+	}
+	v.added[src] = true
+	v.log.source(src)
+	return true
+}
+
+// declareLocked declares the indexed line of src, unless it is
+// already declared. It returns false if the line is new but the
+// definitions have already been written.
+func (v *VCDWriter) declareLocked(src Named, index int) bool {
+	k := vcdVar{src: src, index: index}
+	if _, ok := v.vars[k]; ok {
+		return true
+	}
+	if v.begun {
+		return false
+	}
+	v.vars[k] = ""
+	return true
+}
+
+// vcdKey represents the number j in the VCD identifier format used
+// by the iotracer package.
+func vcdKey(j int) string {
+	var cs []string
+	const digit = 127 - 33
+	const base = 33
+	for loop := true; loop; loop = j != 0 {
+		c := j % digit
+		cs = append(cs, fmt.Sprintf("%c", base+c))
+		j /= digit
+	}
+	return strings.Join(cs, "")
+}
+
+// vcdLayout is the $date format used by iotracer generated VCD
+// dumps. It records no time zone: the trailing "07:00" is literal
+// text, and the date is written and parsed as local time.
+const vcdLayout = "2006-01-02 15:04:05.999999999 07:00"
+
+// vcdTimescale formats a duration as a VCD $timescale.
+func vcdTimescale(d time.Duration) string {
+	for _, u := range []struct {
+		unit string
+		d    time.Duration
+	}{
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+		{"us", time.Microsecond},
+	} {
+		if d%u.d == 0 {
+			return fmt.Sprintf("%d%s", d/u.d, u.unit)
+		}
+	}
+	return fmt.Sprintf("%dns", d/time.Nanosecond)
+}
+
+// vcdRef converts a label into a VCD reference (no whitespace).
+func vcdRef(label string) string {
+	return strings.Join(strings.Fields(label), "_")
+}
+
+// vcdComment escapes text for a VCD $comment section. The text is
+// written on a single line, and any word starting with '$' or '\' is
+// prefixed with '\' so that it cannot end the section, or be read as
+// a VCD command.
+func vcdComment(text string) string {
+	words := strings.Fields(text)
+	for i, w := range words {
+		if strings.HasPrefix(w, "$") || strings.HasPrefix(w, `\`) {
+			words[i] = `\` + w
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// vcdValue formats the value of a change for variable id. A non-zero
+// scale indicates a real variable.
+func vcdValue(ch Change, id string, scale float64) string {
+	if scale != 0 {
+		return fmt.Sprintf("r%.16g %s", float64(ch.New)*scale, id)
+	}
+	if ch.Numeric {
+		return fmt.Sprintf("b%b %s", uint64(ch.New), id)
+	}
+	return fmt.Sprintf("%d%s", ch.New, id)
+}
+
+// beginLocked writes the definitions, if they have not been written
+// yet. The earliest of chs, if any, is VCD timestamp #0.
+func (v *VCDWriter) beginLocked(chs []Change) {
+	if v.begun {
+		return
+	}
+	v.begun = true
+	v.start = time.Now()
+	for _, ch := range chs {
+		if ch.When.Before(v.start) {
+			v.start = ch.When
+		}
+	}
+
+	w := v.w
+	fmt.Fprintf(w, "$date\n\t%s\n$end\n", v.start.Format(vcdLayout))
+	fmt.Fprintf(w, "$version\n\t%s\n$end\n", v.app)
+	fmt.Fprintf(w, "$timescale\n\t%s\n$end\n", vcdTimescale(v.tScale))
+	fmt.Fprintf(w, "$scope module %s $end\n", vcdRef(v.app))
+	var ids []string
+	for _, t := range v.log.order {
+		var lines []int
+		for i := 0; i < t.src.Lines(); i++ {
+			if _, ok := v.vars[vcdVar{src: t.src, index: i}]; ok {
+				lines = append(lines, i)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "$scope module %s $end\n", vcdRef(t.module))
+		for _, i := range lines {
+			k := vcdVar{src: t.src, index: i}
+			id := vcdKey(len(ids))
+			v.vars[k] = id
+			switch {
+			case v.scales[k] != 0:
+				// Real variables have no unknown value.
+				fmt.Fprintf(w, "$var real 64 %s %s $end\n", id, vcdRef(t.label(i)))
+			case t.numeric:
+				fmt.Fprintf(w, "$var integer 64 %s %s $end\n", id, vcdRef(t.label(i)))
+				ids = append(ids, "bx "+id)
+			default:
+				fmt.Fprintf(w, "$var wire 1 %s %s $end\n", id, vcdRef(t.label(i)))
+				ids = append(ids, "x"+id)
+			}
+		}
+		fmt.Fprintln(w, "$upscope $end")
+	}
+	fmt.Fprintln(w, "$upscope $end")
+	fmt.Fprintln(w, "$enddefinitions $end")
+	fmt.Fprintln(w, "#0")
+	fmt.Fprintln(w, "$dumpvars")
+	for _, id := range ids {
+		fmt.Fprintln(w, id)
+	}
+	fmt.Fprintln(w, "$end")
+	v.scheduleLocked()
+}
+
+// scheduleLocked arranges for the output to be flushed within one
+// period.
+func (v *VCDWriter) scheduleLocked() {
+	if v.period <= 0 || v.flushing {
+		return
+	}
+	v.flushing = true
+	time.AfterFunc(v.period, func() {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		v.flushing = false
+		if err := v.w.Flush(); err != nil && v.err == nil {
+			v.err = err
+		}
+	})
+}
+
+// writeLocked writes changes, first writing the definitions if
+// needed.
+func (v *VCDWriter) writeLocked(chs []Change) {
+	if len(chs) == 0 {
+		return
+	}
+	for _, ch := range chs {
+		if ch.Annotation() {
+			continue
+		}
+		if (!v.addLocked(ch.Source) || !v.declareLocked(ch.Source, ch.Index)) && v.err == nil {
+			v.err = fmt.Errorf("line %d of %q was not declared in the VCD definitions", ch.Index, ch.Module)
+		}
+	}
+	v.beginLocked(chs)
+	for _, ch := range chs {
+		k := vcdVar{src: ch.Source, index: ch.Index}
+		id, ok := v.vars[k]
+		if !ok && !ch.Annotation() {
+			continue
+		}
+		stamp := uint64(0)
+		if ch.When.After(v.start) {
+			stamp = uint64(ch.When.Sub(v.start) / v.tScale)
+		}
+		if stamp > v.stamp {
+			// Timestamps never decrease, so out of order
+			// samples are written with the latest stamp.
+			v.stamp = stamp
+			fmt.Fprintf(v.w, "#%d\n", stamp)
+		}
+		line := vcdValue(ch, id, v.scales[k])
+		if ch.Annotation() {
+			line = fmt.Sprintf("$comment\n\t%s: %s\n$end", ch.Module, vcdComment(ch.Text))
+		}
+		if _, err := fmt.Fprintln(v.w, line); err != nil && v.err == nil {
+			v.err = err
+		}
+	}
+	v.scheduleLocked()
+}
+
+// TimedSample records the line changes of a Bank or Flag sample.
+func (v *VCDWriter) TimedSample(when time.Time, src Named, mask, value uint64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeLocked(v.log.sample(when, src, mask, value))
+}
+
+// TimedSampleNum records a change of a Vector value.
+func (v *VCDWriter) TimedSampleNum(when time.Time, src Named, index int, value int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeLocked(v.log.sampleNum(when, src, index, value))
+}
+
+// record writes previously recorded changes, adopting their module
+// names, labels and kinds.
+func (v *VCDWriter) record(chs []Change) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, ch := range chs {
+		v.log.module(ch.Source, ch.Module)
+		if !ch.Annotation() {
+			v.log.label(ch.Source, ch.Index, ch.Label)
+			v.log.source(ch.Source).numeric = ch.Numeric
+		}
+	}
+	v.writeLocked(chs)
+}
+
+// Annotate records text as a VCD comment. The text is escaped by
+// vcdComment(), and ReadVCD() recovers it with its whitespace
+// collapsed to single spaces.
+func (v *VCDWriter) Annotate(when time.Time, src Named, text string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.writeLocked(v.log.annotate(when, src, text))
+}
+
+// Begin writes the VCD definitions of all of the lines traced or
+// labeled so far, without waiting for the first change to be
+// recorded.
+func (v *VCDWriter) Begin() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.beginLocked(nil)
+	return v.err
+}
+
+// Flush writes the definitions, if needed, and all buffered output.
+func (v *VCDWriter) Flush() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.beginLocked(nil)
+	if err := v.w.Flush(); err != nil && v.err == nil {
+		v.err = err
+	}
+	return v.err
+}
+
+// Close flushes the output and, if the underlying io.Writer is an
+// io.Closer, closes it.
+func (v *VCDWriter) Close() error {
+	err := v.Flush()
+	if v.c != nil {
+		if e := v.c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package gpio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVCDWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewVCDWriter(buf, "test", time.Microsecond, 0)
+	f := NewFlag()
+	v := NewVector(1)
+	w.Add(f, "flags")
+	w.Add(v, "values")
+	w.LabelLine(f, 2, "ready")
+
+	// The vector is sampled first, since the flags have no traced
+	// bits when the tracer is set. This writes the definitions.
+	f.SetTimedTracer(w)
+	v.SetTimedTracer(w)
+	f.Set(2, true)
+	f.Get(2)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\n1!\n") {
+		t.Errorf("change not streamed before Close():\n%s", buf.String())
+	}
+	if err := w.LabelLine(f, 2, "busy"); err == nil {
+		t.Error("relabeled a declared line")
+	}
+	v.Set(0, 6)
+	f.Annotate("homing")
+	f.Set(2, false)
+	f.Get(2)
+
+	// Lines of a source first seen after the definitions are
+	// written cannot be recorded.
+	g := NewFlag()
+	g.SetTimedTracer(w)
+	g.Set(0, true)
+	g.Get(0)
+	if err := w.Close(); err == nil {
+		t.Error("undeclared line not reported")
+	}
+	dump := buf.String()
+	for _, want := range []string{
+		"$timescale\n\t1us\n$end",
+		"$scope module flags $end\n$var wire 1 ! ready $end\n$upscope $end\n",
+		"$scope module values $end\n$var integer 64 \" val0 $end",
+		"$dumpvars\nx!\nbx \"\n$end\nb0 \"\n",
+		"\n1!\n",
+		"\nb110 \"\n",
+		"\n$comment\n\tflags: homing\n$end\n",
+		"\n0!\n",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("VCD dump is missing %q:\n%s", want, dump)
+		}
+	}
+}
+
+func TestVCDWriterLabeled(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewVCDWriter(buf, "test", time.Microsecond, 0)
+	f, g := NewFlag(), NewFlag()
+	w.Add(f, "flags")
+	w.Add(g, "idle")
+	w.LabelLine(g, 4, "spare")
+	f.SetTimedTracer(w)
+	f.Set(1, true)
+	f.Get(1)
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	v, err := ReadVCD(buf)
+	if err != nil {
+		t.Fatalf("ReadVCD failed: %v\n%s", err, buf.String())
+	}
+	var paths []string
+	for _, vv := range v.Vars {
+		paths = append(paths, vv.Path())
+	}
+	if got, want := strings.Join(paths, " "), "test.flags.sig1 test.idle.spare"; got != want {
+		t.Errorf("got vars %q want %q", got, want)
+	}
+}
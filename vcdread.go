@@ -0,0 +1,306 @@
+package gpio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VCDVar describes a variable declared in a Value Change Dump.
+type VCDVar struct {
+	// ID is the identifier code used for the variable's changes.
+	ID string
+
+	// Scope lists the names of the enclosing scopes, outermost
+	// first, and Name is the reference of the variable.
+	Scope []string
+	Name  string
+
+	// Kind is the VCD variable type ("wire", "integer", "real",
+	// ...) and Width is its number of bits.
+	Kind  string
+	Width int
+}
+
+// Path returns the scope qualified name of the variable, with
+// components separated by dots.
+func (v VCDVar) Path() string {
+	return strings.Join(append(append([]string(nil), v.Scope...), v.Name), ".")
+}
+
+// VCDEvent is a single value change, or comment, read from a Value
+// Change Dump.
+type VCDEvent struct {
+	// At is the time of the event relative to VCD timestamp #0.
+	At time.Duration
+
+	// Var indexes the changed variable in the VCD Vars. It is -1
+	// for a comment.
+	Var int
+
+	// Value holds the new value of the variable, rounded for real
+	// variables. Known is false if the value contains x or z bits,
+	// in which case Value is 0.
+	Value int64
+	Known bool
+
+	// Text holds the text of a comment, or the value of a string
+	// variable.
+	Text string
+}
+
+// VCD holds the contents of a Value Change Dump.
+type VCD struct {
+	// Date and Version hold the text of the $date and $version
+	// sections. If Date is in the format written by this package
+	// and iotracer, Start holds the local time it represents.
+	Date, Version string
+	Start         time.Time
+
+	// Scale is the duration of one VCD time unit.
+	Scale time.Duration
+
+	// Vars lists the declared variables in declaration order.
+	Vars []VCDVar
+
+	// Events holds all of the value changes and comments in time
+	// order, and End is the time of the last timestamp of the
+	// dump.
+	Events []VCDEvent
+	End    time.Duration
+}
+
+// vcdTokens splits a VCD file into whitespace separated tokens.
+type vcdTokens struct {
+	s *bufio.Scanner
+}
+
+// next returns the next token, or io.EOF.
+func (t *vcdTokens) next() (string, error) {
+	if t.s.Scan() {
+		return t.s.Text(), nil
+	}
+	if err := t.s.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+// section returns the tokens up to the $end of a section.
+func (t *vcdTokens) section(name string) ([]string, error) {
+	var toks []string
+	for {
+		tok, err := t.next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("unterminated %s section", name)
+		} else if err != nil {
+			return nil, err
+		}
+		if tok == "$end" {
+			return toks, nil
+		}
+		toks = append(toks, tok)
+	}
+}
+
+// parseTimescale converts the tokens of a $timescale section into a
+// duration. Scales below one nanosecond are not supported.
+func parseTimescale(toks []string) (time.Duration, error) {
+	s := strings.Join(toks, "")
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i <= 0 {
+		return 0, fmt.Errorf("bad timescale %q", s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad timescale %q: %v", s, err)
+	}
+	var unit time.Duration
+	switch s[i:] {
+	case "s":
+		unit = time.Second
+	case "ms":
+		unit = time.Millisecond
+	case "us", "µs":
+		unit = time.Microsecond
+	case "ns":
+		unit = time.Nanosecond
+	default:
+		return 0, fmt.Errorf("unsupported timescale %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// parseVCDValue converts a VCD scalar value character, or vector of
+// bits, into a value.
+func parseVCDValue(bits string) (int64, bool) {
+	var v uint64
+	for _, c := range bits {
+		switch c {
+		case '0':
+			v <<= 1
+		case '1':
+			v = v<<1 | 1
+		default:
+			return 0, false
+		}
+	}
+	return int64(v), true
+}
+
+// ReadVCD parses a Value Change Dump, such as those written by a
+// VCDWriter, ExportVCD() or iotracer.
+func ReadVCD(r io.Reader) (*VCD, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	s.Split(bufio.ScanWords)
+	t := &vcdTokens{s: s}
+
+	v := &VCD{Scale: time.Nanosecond}
+	ids := make(map[string][]int)
+	var scope []string
+	for defining := true; defining; {
+		tok, err := t.next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("missing $enddefinitions")
+		} else if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(tok, "$") {
+			return nil, fmt.Errorf("unexpected %q in VCD definitions", tok)
+		}
+		name := tok[1:]
+		toks, err := t.section(name)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "date":
+			v.Date = strings.Join(toks, " ")
+			v.Start, _ = time.ParseInLocation(vcdLayout, v.Date, time.Local)
+		case "version":
+			v.Version = strings.Join(toks, " ")
+		case "timescale":
+			if v.Scale, err = parseTimescale(toks); err != nil {
+				return nil, err
+			}
+		case "scope":
+			if len(toks) != 2 {
+				return nil, fmt.Errorf("bad $scope %q", toks)
+			}
+			scope = append(scope, toks[1])
+		case "upscope":
+			if len(scope) == 0 {
+				return nil, fmt.Errorf("unbalanced $upscope")
+			}
+			scope = scope[:len(scope)-1]
+		case "var":
+			if len(toks) < 4 {
+				return nil, fmt.Errorf("bad $var %q", toks)
+			}
+			width, err := strconv.Atoi(toks[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad $var width %q: %v", toks[1], err)
+			}
+			ids[toks[2]] = append(ids[toks[2]], len(v.Vars))
+			v.Vars = append(v.Vars, VCDVar{
+				ID:    toks[2],
+				Scope: append([]string(nil), scope...),
+				Name:  strings.Join(toks[3:], ""),
+				Kind:  toks[0],
+				Width: width,
+			})
+		case "enddefinitions":
+			defining = false
+		}
+	}
+
+	var at time.Duration
+	for {
+		tok, err := t.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		var value, id string
+		switch c := tok[0]; {
+		case c == '#':
+			stamp, err := strconv.ParseUint(tok[1:], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad timestamp %q: %v", tok, err)
+			}
+			at = time.Duration(stamp) * v.Scale
+			if at > v.End {
+				v.End = at
+			}
+			continue
+		case tok == "$comment":
+			toks, err := t.section("comment")
+			if err != nil {
+				return nil, err
+			}
+			for i, tok := range toks {
+				// Undo the escaping of vcdComment().
+				if strings.HasPrefix(tok, `\$`) || strings.HasPrefix(tok, `\\`) {
+					toks[i] = tok[1:]
+				}
+			}
+			v.Events = append(v.Events, VCDEvent{At: at, Var: -1, Text: strings.Join(toks, " ")})
+			continue
+		case c == '$':
+			// $dumpvars, $dumpall, $dumpon, $dumpoff and
+			// their $end markers only group value changes.
+			continue
+		case c == 'b' || c == 'B' || c == 'r' || c == 'R' || c == 's' || c == 'S':
+			value = tok
+			if id, err = t.next(); err != nil {
+				return nil, fmt.Errorf("truncated value change %q", tok)
+			}
+		default:
+			value, id = tok[:1], tok[1:]
+		}
+		vars, ok := ids[id]
+		if !ok {
+			return nil, fmt.Errorf("change %q for undeclared variable %q", value, id)
+		}
+		ev := VCDEvent{At: at}
+		switch value[0] {
+		case 'b', 'B':
+			ev.Value, ev.Known = parseVCDValue(value[1:])
+		case 'r', 'R':
+			f, err := strconv.ParseFloat(value[1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad real value %q: %v", value, err)
+			}
+			ev.Value, ev.Known = int64(math.Round(f)), true
+		case 's', 'S':
+			ev.Text = value[1:]
+		default:
+			ev.Value, ev.Known = parseVCDValue(value)
+		}
+		for _, i := range vars {
+			ev.Var = i
+			v.Events = append(v.Events, ev)
+		}
+	}
+	sort.SliceStable(v.Events, func(i, j int) bool { return v.Events[i].At < v.Events[j].At })
+	return v, nil
+}
+
+// Find returns the index in Vars of the variable named name. The name
+// matches either the Name of the variable, or a dot separated suffix
+// of its Path(). If several variables match, the first is returned.
+func (v *VCD) Find(name string) (int, bool) {
+	for i, vv := range v.Vars {
+		if p := vv.Path(); vv.Name == name || p == name || strings.HasSuffix(p, "."+name) {
+			return i, true
+		}
+	}
+	return -1, false
+}